@@ -0,0 +1,10 @@
+package datatypes
+
+//// Definitions
+
+// CacheStats describes how well the cache of Dynatrace responses is working
+type CacheStats struct {
+	Entries int
+	Hits    int64
+	Misses  int64
+}
@@ -4,9 +4,42 @@ package datatypes
 
 // Config contains the config necessary for the app to run
 type Config struct {
-	APIToken string
-	Env      string
-	Server   string
+	APIToken              Secret
+	APITokenFile          string
+	CachePastTTLSecs      int
+	CacheTTLSecs          int
+	CAFile                string
+	CallbackAllowedHosts  []string
+	ConfigFile            string
+	DefaultEvaluationMins int
+	DefaultEventAge       int
+	Env                   string
+	EvaluationWorkers     int
+	HistoryFile           string
+	IdleTimeoutSecs       int
+	ListenAddress         string
+	LogLevel              string
+	MaxRetries            int
+	Port                  int
+	Proxy                 string
+	ReadTimeoutSecs       int
+	ReloadIntervalSecs    int
+	Server                string
+	ShutdownTimeoutSecs   int
+	SignaturesDir         string
+	Tenants               map[string]Tenant
+	TimeoutSecs           int
+	WriteTimeoutSecs      int
+}
+
+// Tenant is a named Dynatrace environment which requests can select with their Tenant field
+type Tenant struct {
+	APIToken     Secret
+	APITokenFile string
+	CAFile       string
+	Env          string
+	Proxy        string
+	Server       string
 }
 
 //// Example Values
@@ -16,6 +49,18 @@ var (
 		Server:   "1234.live.dynatrace.com",
 		Env:      "envSet",
 	}
+
+	tenantsConfig = Config{
+		APIToken: "aj0aw9efj0a9wejf09awejf",
+		Server:   "1234.live.dynatrace.com",
+		Tenants: map[string]Tenant{
+			"staging": {
+				APIToken: "stagingtoken0a9wejf09a",
+				Env:      "stagingEnv",
+				Server:   "staging.live.dynatrace.com",
+			},
+		},
+	}
 )
 
 //// Example Accessors
@@ -24,3 +69,8 @@ var (
 func GetConfiguredConfig() Config {
 	return configuredConfig
 }
+
+// GetTenantsConfig returns a config with a default environment and a staging tenant
+func GetTenantsConfig() Config {
+	return tenantsConfig
+}
@@ -6,6 +6,7 @@ package datatypes
 type DeploymentEvent struct {
 	StartTime         int64  `json:"startTime"`
 	EndTime           int64  `json:"endTime"`
+	CorrelationID     string `json:"correlationId"`
 	DeploymentName    string `json:"deploymentName"`
 	DeploymentVersion string `json:"deploymentVersion"`
 }
@@ -15,6 +16,50 @@ type DeploymentEvents struct {
 	Events []DeploymentEvent `json:"events"`
 }
 
+// DeploymentRequest defines the parameters needed to push a Deployment Event to Dynatrace
+type DeploymentRequest struct {
+	APIToken          Secret
+	DeploymentName    string
+	DeploymentProject string
+	DeploymentVersion string
+	DTEnv             string
+	DTServer          string
+	Properties        map[string]string
+	ServiceID         string
+	Tenant            string
+}
+
+// DeploymentEventPush defines the body we send to the Dt Events API to create a Deployment Event
+type DeploymentEventPush struct {
+	EventType         string            `json:"eventType"`
+	AttachRules       AttachRules       `json:"attachRules"`
+	DeploymentName    string            `json:"deploymentName"`
+	DeploymentProject string            `json:"deploymentProject,omitempty"`
+	DeploymentVersion string            `json:"deploymentVersion"`
+	Source            string            `json:"source"`
+	CustomProperties  map[string]string `json:"customProperties,omitempty"`
+}
+
+// AttachRules defines which Dynatrace entities an event is attached to
+type AttachRules struct {
+	EntityIds []string `json:"entityIds"`
+}
+
+// EventStoreResult defines what we receive from the Dt Events API after pushing an event
+type EventStoreResult struct {
+	StoredEventIds       []int64  `json:"storedEventIds"`
+	StoredIds            []string `json:"storedIds"`
+	StoredCorrelationIds []string `json:"storedCorrelationIds"`
+}
+
+// DeploymentReturn defines the spec for what needs to be returned to the requester of /deployment
+type DeploymentReturn struct {
+	CorrelationID string
+	Error         bool
+	ErrorCode     string `json:",omitempty"`
+	Response      []string
+}
+
 // Timestamps represents a start and end time for Deployment events
 type Timestamps struct {
 	StartTime int64
@@ -63,6 +108,17 @@ var (
 		},
 	}
 
+	validDeploymentRequest = DeploymentRequest{
+		APIToken:          "asdf1234",
+		DeploymentName:    "Deploy checkout",
+		DeploymentVersion: "1.2.3",
+		DTServer:          "asdf1234.live.dynatrace.com",
+		Properties: map[string]string{
+			"pipeline": "1234",
+		},
+		ServiceID: "SERVICE-5D4E743B2BF0CCF5",
+	}
+
 	singleTimestamp = Timestamps{
 		StartTime: 1234,
 		EndTime:   2345,
@@ -91,6 +147,11 @@ func GetSingleTimestamps() []Timestamps {
 	return singleTimestamps
 }
 
+// GetValidDeploymentRequest returns a DeploymentRequest with everything needed to push a Deployment Event
+func GetValidDeploymentRequest() DeploymentRequest {
+	return validDeploymentRequest
+}
+
 // GetSingleTimestamp returns a Timestamps object
 func GetSingleTimestamp() Timestamps {
 	return singleTimestamp
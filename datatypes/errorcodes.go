@@ -0,0 +1,29 @@
+package datatypes
+
+//// Definitions
+
+// Error codes returned with failed requests, so callers can tell why an evaluation could not be performed
+const (
+	// ErrorCodeAuthFailed means Dynatrace rejected the API token
+	ErrorCodeAuthFailed = "AUTH_FAILED"
+	// ErrorCodeCancelled means the caller went away or the server shut down before the evaluation finished
+	ErrorCodeCancelled = "CANCELLED"
+	// ErrorCodeDynatraceError means Dynatrace failed to serve the request or sent something we couldn't read
+	ErrorCodeDynatraceError = "DYNATRACE_ERROR"
+	// ErrorCodeDynatraceUnreachable means Dynatrace could not be reached
+	ErrorCodeDynatraceUnreachable = "DYNATRACE_UNREACHABLE"
+	// ErrorCodeInternal means goDynaPerfSignature itself failed
+	ErrorCodeInternal = "INTERNAL_ERROR"
+	// ErrorCodeInvalidMetricSelector means Dynatrace rejected one of the PSMetrics
+	ErrorCodeInvalidMetricSelector = "INVALID_METRIC_SELECTOR"
+	// ErrorCodeInvalidRequest means the request parameters were missing or invalid
+	ErrorCodeInvalidRequest = "INVALID_REQUEST"
+	// ErrorCodeNotFound means Dynatrace could not find the requested entity
+	ErrorCodeNotFound = "NOT_FOUND"
+	// ErrorCodeQueueFull means too many evaluations are already waiting to run in the background
+	ErrorCodeQueueFull = "QUEUE_FULL"
+	// ErrorCodeRateLimited means Dynatrace kept rate limiting us after every retry
+	ErrorCodeRateLimited = "RATE_LIMITED"
+	// ErrorCodeTimeout means the evaluation or a request to Dynatrace ran out of time
+	ErrorCodeTimeout = "TIMEOUT"
+)
@@ -0,0 +1,48 @@
+package datatypes
+
+import "time"
+
+//// Definitions
+
+// Statuses of an EvaluationJob
+const (
+	// EvaluationStatusPending means the job is waiting for a worker, or for its evaluation window to finish
+	EvaluationStatusPending = "pending"
+	// EvaluationStatusRunning means a worker is evaluating the job
+	EvaluationStatusRunning = "running"
+	// EvaluationStatusDone means the job finished and its Result is final
+	EvaluationStatusDone = "done"
+)
+
+// Statuses of a CallbackDelivery
+const (
+	// CallbackStatusPending means the callback hasn't been delivered yet, but will be tried again
+	CallbackStatusPending = "pending"
+	// CallbackStatusDelivered means the callback URL accepted the result
+	CallbackStatusDelivered = "delivered"
+	// CallbackStatusFailed means every attempt to deliver the result failed
+	CallbackStatusFailed = "failed"
+)
+
+// EvaluationJob describes an evaluation which was submitted to run in the background
+type EvaluationJob struct {
+	ID            string
+	Status        string
+	Attempts      int `json:",omitempty"`
+	SubmittedAt   time.Time
+	StartedAt     *time.Time                  `json:",omitempty"`
+	NextAttemptAt *time.Time                  `json:",omitempty"`
+	FinishedAt    *time.Time                  `json:",omitempty"`
+	Result        *PerformanceSignatureReturn `json:",omitempty"`
+	Callback      *CallbackDelivery           `json:",omitempty"`
+}
+
+// CallbackDelivery tracks sending the Result of an EvaluationJob to its CallbackURL
+type CallbackDelivery struct {
+	URL            string
+	Status         string
+	Attempts       int
+	LastStatusCode int        `json:",omitempty"`
+	LastError      string     `json:",omitempty"`
+	DeliveredAt    *time.Time `json:",omitempty"`
+}
@@ -0,0 +1,88 @@
+package datatypes
+
+import "time"
+
+//// Definitions
+
+// EvaluationRecord is a finished evaluation as it is kept in the history, with everything needed to tell why it
+// passed or failed
+type EvaluationRecord struct {
+	ID         string
+	Request    PerformanceSignature
+	Services   []ServiceEvaluation
+	Result     PerformanceSignatureReturn
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// ServiceEvaluation holds the windows and raw metric values a single service was evaluated with
+type ServiceEvaluation struct {
+	ServiceID string
+	Windows   []Timestamps
+	Metrics   ComparisonMetrics
+}
+
+// EvaluationSummary is the short form of an EvaluationRecord used when listing the history
+type EvaluationSummary struct {
+	ID               string
+	ServiceIDs       []string
+	Signature        string `json:",omitempty"`
+	SignatureVersion int    `json:",omitempty"`
+	Pass             bool
+	Error            bool
+	ErrorCode        string `json:",omitempty"`
+	StartedAt        time.Time
+	FinishedAt       time.Time
+}
+
+//// Example Values
+var (
+	historyStartedAt  = time.Date(2020, 9, 12, 12, 30, 0, 0, time.UTC)
+	historyFinishedAt = time.Date(2020, 9, 12, 12, 30, 2, 0, time.UTC)
+
+	evaluationRecord = EvaluationRecord{
+		ID: "00000000000000000000000000000001",
+		Request: PerformanceSignature{
+			DTServer: "1234.live.dynatrace.com",
+			PSMetrics: map[string]PSMetric{
+				"builtin:service.response.time:avg": {
+					StaticThreshold:  Threshold{Value: 500, Unit: "ms"},
+					ValidationMethod: "static",
+				},
+			},
+			ServiceID: "SERVICE-5D4E743B2BF0CCF5",
+		},
+		Services: []ServiceEvaluation{
+			{
+				ServiceID: "SERVICE-5D4E743B2BF0CCF5",
+				Windows:   []Timestamps{{StartTime: 1599912000000, EndTime: 1599913800000}},
+				Metrics: ComparisonMetrics{
+					CurrentMetrics: DynatraceMetricsResponse{
+						Metrics: []MetricValuesArray{
+							{
+								MetricId: "builtin:service.response.time:avg",
+								MetricValues: []MetricValues{
+									{Dimensions: []string{"SERVICE-5D4E743B2BF0CCF5"}, Timestamps: []int64{1599913800000}, Values: []float64{82120}},
+								},
+							},
+						},
+					},
+					Units: map[string]string{"builtin:service.response.time:avg": "MicroSecond"},
+				},
+			},
+		},
+		Result: PerformanceSignatureReturn{
+			Pass:     true,
+			Response: []string{"Current builtin:service.response.time:avg value is 82.12ms, which is under the static threshold of 500ms"},
+		},
+		StartedAt:  historyStartedAt,
+		FinishedAt: historyFinishedAt,
+	}
+)
+
+//// Example Accessors
+
+// GetEvaluationRecord returns a passing EvaluationRecord of a single service
+func GetEvaluationRecord() EvaluationRecord {
+	return evaluationRecord
+}
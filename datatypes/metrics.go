@@ -1,18 +1,80 @@
 package datatypes
 
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 //// Definitions
 
 // Metric defines a Dynatrace Service we'd like to investigate and how we'd like to validate it
 type PSMetric struct {
-	RelativeThreshold float64
-	StaticThreshold   float64
+	RelativeThreshold Threshold
+	Resolution        string `json:",omitempty"`
+	SeriesAggregation string `json:",omitempty"`
+	StaticThreshold   Threshold
 	ValidationMethod  string
 }
 
+// Threshold is a limit for a metric. It is sent either as a number in the metric's own unit, or as a string with a
+// unit such as "500ms" or "2%"
+type Threshold struct {
+	Value float64
+	Unit  string
+}
+
+// UnmarshalJSON reads a Threshold from a number or a string with a unit
+func (t *Threshold) UnmarshalJSON(b []byte) error {
+	var value float64
+	if err := json.Unmarshal(b, &value); err == nil {
+		*t = Threshold{Value: value}
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(b, &text); err != nil {
+		return fmt.Errorf("a threshold must be a number or a string like \"500ms\", not %v", string(b))
+	}
+
+	// Split the number from the unit which follows it
+	text = strings.TrimSpace(text)
+	split := strings.IndexFunc(text, func(r rune) bool {
+		return !strings.ContainsRune("0123456789.+-eE", r)
+	})
+	if split < 0 {
+		split = len(text)
+	}
+
+	value, err := strconv.ParseFloat(text[:split], 64)
+	if err != nil {
+		return fmt.Errorf("could not read the threshold '%v': it must start with a number", text)
+	}
+
+	*t = Threshold{Value: value, Unit: strings.TrimSpace(text[split:])}
+	return nil
+}
+
+// MarshalJSON writes a Threshold back the way it was sent
+func (t Threshold) MarshalJSON() ([]byte, error) {
+	if t.Unit == "" {
+		return json.Marshal(t.Value)
+	}
+	return json.Marshal(t.String())
+}
+
+func (t Threshold) String() string {
+	return strconv.FormatFloat(t.Value, 'f', -1, 64) + t.Unit
+}
+
 // ComparisonMetrics has a current and previous set of metrics to compare
 type ComparisonMetrics struct {
 	CurrentMetrics  DynatraceMetricsResponse
 	PreviousMetrics DynatraceMetricsResponse
+
+	// Units maps each PSMetrics name to the Dynatrace unit of its values, when it is known
+	Units map[string]string
 }
 
 // DynatraceMetricsResponse defines what we receive from the Dt Metrics v2 API
@@ -33,6 +95,40 @@ type MetricValues struct {
 	Values     []float64 `json:"values"`
 }
 
+// UnmarshalJSON reads the data points of a metric, dropping the ones Dynatrace had no data for. Dynatrace sends
+// those as null, which would otherwise be read as 0
+func (m *MetricValues) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Dimensions []string   `json:"dimensions"`
+		Timestamps []int64    `json:"timestamps"`
+		Values     []*float64 `json:"values"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	*m = MetricValues{Dimensions: raw.Dimensions}
+	for i, value := range raw.Values {
+		if value == nil {
+			continue
+		}
+		if i < len(raw.Timestamps) {
+			m.Timestamps = append(m.Timestamps, raw.Timestamps[i])
+		}
+		m.Values = append(m.Values, *value)
+	}
+
+	return nil
+}
+
+// MetricDescriptor defines what we receive from the Dt Metrics v2 API about a single metric
+type MetricDescriptor struct {
+	MetricID         string   `json:"metricId"`
+	DisplayName      string   `json:"displayName"`
+	Unit             string   `json:"unit"`
+	AggregationTypes []string `json:"aggregationTypes"`
+}
+
 //// Example Values
 var (
 	validFailingComparisonMetrics = ComparisonMetrics{
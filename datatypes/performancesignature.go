@@ -4,20 +4,62 @@ package datatypes
 
 // PerformanceSignature is a struct defining all of the parameters we need to calculate a performance signature
 type PerformanceSignature struct {
-	APIToken       string
-	DTEnv          string
-	DTServer       string
-	EvaluationMins int
-	EventAge       int
-	PSMetrics      map[string]PSMetric
-	ServiceID      string
+	APIToken             Secret
+	BaselineWindow       *TimeWindow
+	BypassCache          bool
+	CallbackSecret       Secret
+	CallbackURL          string
+	CorrelationID        string
+	CurrentWindow        *TimeWindow
+	DTEnv                string
+	DTServer             string
+	EvaluationMins       int
+	EvaluationOffsetMins int
+	EventAge             int
+	PSMetrics            map[string]PSMetric
+	Quorum               int
+	Resolution           string
+	SeriesAggregation    string
+	ServiceID            string
+	ServiceIDs           []string
+	Signature            string
+	SignatureVersion     int
+	Tenant               string
+	TimeoutSecs          int
+	ValidateMetrics      bool
+	WaitForWindow        bool
+}
+
+// TimeWindow is an explicit evaluation timeframe which is used instead of Deployment Events. From and To accept
+// epoch milliseconds, RFC3339 timestamps, or expressions relative to the current time such as now-30m
+type TimeWindow struct {
+	From string
+	To   string
 }
 
 // PerformanceSignatureReturn defines the spec for what needs to be returned to the requester
 type PerformanceSignatureReturn struct {
-	Error    bool
-	Pass     bool
-	Response []string
+	Error          bool
+	ErrorCode      string `json:",omitempty"`
+	HistoryID      string `json:",omitempty"`
+	Pass           bool
+	Pending        bool `json:",omitempty"`
+	Response       []string
+	RetryAfterSecs int             `json:",omitempty"`
+	Retries        int             `json:",omitempty"`
+	RetryWaitMs    int64           `json:",omitempty"`
+	ServiceResults []ServiceResult `json:",omitempty"`
+}
+
+// ServiceResult is the outcome of evaluating a single service when several services were requested
+type ServiceResult struct {
+	ServiceID      string
+	Error          bool
+	ErrorCode      string `json:",omitempty"`
+	Pass           bool
+	Pending        bool `json:",omitempty"`
+	RetryAfterSecs int  `json:",omitempty"`
+	Response       []string
 }
 
 //// Example Values
@@ -38,7 +80,7 @@ var (
 		EventAge:       10234,
 		PSMetrics: map[string]PSMetric{
 			"dummy_metric_name:avg": {
-				RelativeThreshold: 20,
+				RelativeThreshold: Threshold{Value: 20},
 				ValidationMethod:  "relative",
 			},
 		},
@@ -51,7 +93,7 @@ var (
 		EventAge:       992348,
 		PSMetrics: map[string]PSMetric{
 			"dummy_metric_name:avg": {
-				RelativeThreshold: 0,
+				RelativeThreshold: Threshold{},
 				ValidationMethod:  "relative",
 			},
 		},
@@ -63,7 +105,7 @@ var (
 		EvaluationMins: 5,
 		PSMetrics: map[string]PSMetric{
 			"dummy_metric_name:percentile(90)": {
-				StaticThreshold:  1234.1234,
+				StaticThreshold:  Threshold{Value: 1234.1234},
 				ValidationMethod: "static",
 			},
 		},
@@ -76,6 +118,18 @@ var (
 		Response: []string{"PASS - builtin:service.response.time:avg improvement to 82122.06 from 150879.00. (Difference: -68756.94)"},
 	}
 
+	validPerformanceSignatureReturnPending = PerformanceSignatureReturn{
+		Pending:        true,
+		RetryAfterSecs: 120,
+		Response:       []string{"PENDING - the evaluation window from 1234 to 2345 has not finished, or its data is still being ingested. Retry in 120 seconds"},
+	}
+
+	validPerformanceSignatureReturnAuthFailed = PerformanceSignatureReturn{
+		Error:     true,
+		ErrorCode: ErrorCodeAuthFailed,
+		Response:  []string{"Encountered error gathering event timestamps from Dynatrace: invalid status code from Dynatrace: 401 (Token Authentication failed)"},
+	}
+
 	validPerformanceSignatureReturnFailure = PerformanceSignatureReturn{
 		Pass:     false,
 		Response: []string{"No previous metrics to compare against for metric dummy_metric_name:avg", "PASS - dummy_metric_name:percentile(90) is below the static threshold (1234.12) with a value of 12.34."},
@@ -108,6 +162,16 @@ func GetValidPerformanceSignatureReturnSuccess() PerformanceSignatureReturn {
 	return validPerformanceSignatureReturnSuccess
 }
 
+// GetValidPerformanceSignatureReturnPending returns a PerformanceSignatureReturn that is waiting on its window
+func GetValidPerformanceSignatureReturnPending() PerformanceSignatureReturn {
+	return validPerformanceSignatureReturnPending
+}
+
+// GetValidPerformanceSignatureReturnAuthFailed returns a PerformanceSignatureReturn for a token Dynatrace rejected
+func GetValidPerformanceSignatureReturnAuthFailed() PerformanceSignatureReturn {
+	return validPerformanceSignatureReturnAuthFailed
+}
+
 // GetValidPerformanceSignatureReturnFailure returns a PerformanceSignatureReturn that failed
 func GetValidPerformanceSignatureReturnFailure() PerformanceSignatureReturn {
 	return validPerformanceSignatureReturnFailure
@@ -0,0 +1,35 @@
+package datatypes
+
+import "encoding/json"
+
+//// Definitions
+
+// maskedSecret is what a Secret which is set prints as
+const maskedSecret = "****"
+
+// Secret is a credential, such as an API token. It prints and marshals to JSON masked, so it can't leak into logs,
+// error messages or persisted records. Reveal returns the actual value for the places which need it
+type Secret string
+
+// Reveal returns the actual value of the Secret
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// String masks the Secret, while still showing whether it is set
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return maskedSecret
+}
+
+// GoString masks the Secret when it is printed with %#v
+func (s Secret) GoString() string {
+	return `"` + s.String() + `"`
+}
+
+// MarshalJSON writes the Secret masked. Reading a Secret from JSON is unchanged, so requests can still pass one
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
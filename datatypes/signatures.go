@@ -0,0 +1,49 @@
+package datatypes
+
+import "time"
+
+//// Definitions
+
+// Signature is a named set of metrics stored on the server, which requests can reference instead of passing their
+// own PSMetrics
+type Signature struct {
+	Name              string
+	EvaluationMins    int `json:",omitempty"`
+	PSMetrics         map[string]PSMetric
+	Resolution        string `json:",omitempty"`
+	SeriesAggregation string `json:",omitempty"`
+
+	// Version counts the changes made to the signature through the API, starting at 1
+	Version   int        `json:",omitempty"`
+	UpdatedAt *time.Time `json:",omitempty"`
+}
+
+//// Example Values
+var (
+	validSignature = Signature{
+		Name: "checkout-api",
+		PSMetrics: map[string]PSMetric{
+			"builtin:service.response.time:avg": {
+				StaticThreshold:  Threshold{Value: 500, Unit: "ms"},
+				ValidationMethod: "static",
+			},
+			"builtin:service.errors.total.rate:avg": {
+				RelativeThreshold: Threshold{Value: 1},
+				ValidationMethod:  "relative",
+			},
+		},
+	}
+)
+
+//// Example Accessors
+
+// GetValidSignature returns a Signature with a static and a relative metric
+func GetValidSignature() Signature {
+	// Copy the metrics, so callers can change them without affecting other tests
+	signature := validSignature
+	signature.PSMetrics = map[string]PSMetric{}
+	for name, metric := range validSignature.PSMetrics {
+		signature.PSMetrics[name] = metric
+	}
+	return signature
+}
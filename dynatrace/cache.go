@@ -0,0 +1,200 @@
+package dynatrace
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+)
+
+const (
+	// settledDataAge is how old data must be before Dynatrace is done ingesting it, so it won't change anymore
+	settledDataAge = 5 * time.Minute
+
+	// maxCacheEntries bounds the memory the response cache can use
+	maxCacheEntries = 1000
+
+	// eventsCacheTTL caps how long Deployment Events are cached. Deployments pushed through the Client clear them
+	// right away, but ones pushed by anything else are only seen once their entry expires
+	eventsCacheTTL = 10 * time.Second
+)
+
+// responseCache holds the bodies of recent Dynatrace responses, so repeated evaluations of the same service and
+// windows don't query Dynatrace again
+type responseCache struct {
+	lock    sync.Mutex
+	entries map[string]responseCacheEntry
+	hits    int64
+	misses  int64
+
+	// ttl is how long responses are kept. pastTTL is used instead for windows which ended long enough ago that
+	// their data won't change
+	ttl     time.Duration
+	pastTTL time.Duration
+}
+
+type responseCacheEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+func newResponseCache(ttl time.Duration, pastTTL time.Duration) *responseCache {
+	return &responseCache{
+		entries: map[string]responseCacheEntry{},
+		ttl:     ttl,
+		pastTTL: pastTTL,
+	}
+}
+
+// enabled checks whether any responses are cached at all
+func (c *responseCache) enabled() bool {
+	return c.ttl > 0 || c.pastTTL > 0
+}
+
+// ttlFor picks how long a response for a window ending at the given epoch milliseconds is kept. An end of 0 means
+// the window runs until now
+func (c *responseCache) ttlFor(to int64, now time.Time) time.Duration {
+	if to != 0 && now.Sub(time.Unix(0, to*int64(time.Millisecond))) > settledDataAge {
+		return c.pastTTL
+	}
+	return c.ttl
+}
+
+func (c *responseCache) get(key string, now time.Time) ([]byte, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || now.After(entry.expires) {
+		delete(c.entries, key)
+		c.misses++
+		return nil, false
+	}
+
+	c.hits++
+	return entry.body, true
+}
+
+func (c *responseCache) set(key string, body []byte, ttl time.Duration, now time.Time) {
+	if ttl <= 0 {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(c.entries) >= maxCacheEntries {
+		c.evict(now)
+	}
+	c.entries[key] = responseCacheEntry{body: body, expires: now.Add(ttl)}
+}
+
+// forget drops the entries whose key matches
+func (c *responseCache) forget(match func(key string) bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for key := range c.entries {
+		if match(key) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// evict drops the expired entries. If the cache is still full, the entries closest to expiring are dropped too
+func (c *responseCache) evict(now time.Time) {
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+
+	for len(c.entries) >= maxCacheEntries {
+		var oldestKey string
+		var oldest time.Time
+		for key, entry := range c.entries {
+			if oldestKey == "" || entry.expires.Before(oldest) {
+				oldestKey = key
+				oldest = entry.expires
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+}
+
+func (c *responseCache) stats() datatypes.CacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return datatypes.CacheStats{
+		Entries: len(c.entries),
+		Hits:    c.hits,
+		Misses:  c.misses,
+	}
+}
+
+// cachedGet performs a GET request through the response cache. to is the end of the queried window in epoch
+// milliseconds, or 0 if it runs until now
+func (c *Client) cachedGet(ctx context.Context, env Environment, path string, query url.Values, to int64, out interface{}) error {
+	if !c.cache.enabled() {
+		return c.do(ctx, "GET", env, path, query, nil, out)
+	}
+
+	return c.cachedGetFor(ctx, env, path, query, c.cache.ttlFor(to, time.Now()), out)
+}
+
+// cachedGetFor performs a GET request through the response cache, keeping the response for ttl
+func (c *Client) cachedGetFor(ctx context.Context, env Environment, path string, query url.Values, ttl time.Duration, out interface{}) error {
+	key := cacheKey(env, path, query)
+	now := time.Now()
+
+	if !bypassCache(ctx) {
+		if body, ok := c.cache.get(key, now); ok {
+			err := json.Unmarshal(body, out)
+			if err != nil {
+				return &DecodeError{Err: err}
+			}
+			return nil
+		}
+	}
+
+	var body json.RawMessage
+	err := c.do(ctx, "GET", env, path, query, nil, &body)
+	if err != nil {
+		return err
+	}
+	c.cache.set(key, body, ttl, now)
+
+	err = json.Unmarshal(body, out)
+	if err != nil {
+		return &DecodeError{Err: err}
+	}
+	return nil
+}
+
+// cacheKey identifies a response in the cache. The token is part of it, so a response is only reused for a caller who
+// could have fetched it themselves
+func cacheKey(env Environment, path string, query url.Values) string {
+	return env.Server + "|" + env.Env + "|" + env.APIToken.Reveal() + "|" + path + "?" + query.Encode()
+}
+
+// CacheStats returns how often the Client's responses were served from its cache
+func (c *Client) CacheStats() datatypes.CacheStats {
+	return c.cache.stats()
+}
+
+type cacheBypassKey struct{}
+
+// WithCacheBypass returns a context whose requests always go to Dynatrace. Their responses still refresh the cache
+func WithCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassKey{}, true)
+}
+
+// bypassCache checks whether a context asked to skip the cache
+func bypassCache(ctx context.Context) bool {
+	bypass, _ := ctx.Value(cacheBypassKey{}).(bool)
+	return bypass
+}
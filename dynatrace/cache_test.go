@@ -0,0 +1,114 @@
+package dynatrace
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedGet(t *testing.T) {
+	requests := 0
+	server, client, env := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"result":[{"metricId":"dummy_metric_name:avg","data":[{"dimensions":["dim1"],"timestamps":[1234],"values":[1234.1234]}]}]}`))
+	})
+	defer server.Close()
+	client.cache = newResponseCache(time.Minute, time.Hour)
+
+	query := MetricsQuery{MetricSelector: "dummy_metric_name:avg", EntityID: "asdf", From: 1234, To: 2345}
+	expected := datatypes.GetValidPassingComparisonMetrics().CurrentMetrics
+
+	// The first query goes to Dynatrace and the second is served from the cache
+	for i := 0; i < 2; i++ {
+		response, err := client.QueryMetrics(context.Background(), env, query)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, response)
+	}
+	assert.Equal(t, 1, requests)
+
+	// Bypassing the cache always goes to Dynatrace
+	response, err := client.QueryMetrics(WithCacheBypass(context.Background()), env, query)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, response)
+	assert.Equal(t, 2, requests)
+
+	// A different window or token is a different entry
+	query.To = 3456
+	client.QueryMetrics(context.Background(), env, query)
+	env.APIToken = "other"
+	client.QueryMetrics(context.Background(), env, query)
+	assert.Equal(t, 4, requests)
+
+	assert.Equal(t, datatypes.CacheStats{Entries: 3, Hits: 1, Misses: 3}, client.CacheStats())
+}
+
+func TestCachedGetDisabled(t *testing.T) {
+	requests := 0
+	server, client, env := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"result":[]}`))
+	})
+	defer server.Close()
+
+	query := MetricsQuery{MetricSelector: "dummy_metric_name:avg", EntityID: "asdf", From: 1234, To: 2345}
+	client.QueryMetrics(context.Background(), env, query)
+	client.QueryMetrics(context.Background(), env, query)
+
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, datatypes.CacheStats{}, client.CacheStats())
+}
+
+func TestCachedGetUndecodable(t *testing.T) {
+	server, client, env := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result":"not a list"}`))
+	})
+	defer server.Close()
+	client.cache = newResponseCache(time.Minute, time.Hour)
+
+	// The response is undecodable both when it comes from Dynatrace and when it comes from the cache
+	query := MetricsQuery{MetricSelector: "dummy_metric_name:avg", EntityID: "asdf", From: 1234, To: 2345}
+	for i := 0; i < 2; i++ {
+		_, err := client.QueryMetrics(context.Background(), env, query)
+		assert.IsType(t, &DecodeError{}, err)
+	}
+	assert.Equal(t, int64(1), client.CacheStats().Hits)
+}
+
+func TestCacheTTLFor(t *testing.T) {
+	cache := newResponseCache(time.Minute, time.Hour)
+	now := time.Unix(1600000000, 0)
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+
+	assert.Equal(t, time.Minute, cache.ttlFor(0, now))
+	assert.Equal(t, time.Minute, cache.ttlFor(nowMs, now))
+	assert.Equal(t, time.Minute, cache.ttlFor(nowMs-int64(time.Minute/time.Millisecond), now))
+	assert.Equal(t, time.Hour, cache.ttlFor(nowMs-int64(time.Hour/time.Millisecond), now))
+}
+
+func TestCacheExpiryAndEviction(t *testing.T) {
+	cache := newResponseCache(time.Minute, time.Hour)
+	now := time.Now()
+
+	cache.set("key", []byte("{}"), time.Minute, now)
+	_, ok := cache.get("key", now.Add(30*time.Second))
+	assert.True(t, ok)
+	_, ok = cache.get("key", now.Add(2*time.Minute))
+	assert.False(t, ok)
+
+	for i := 0; i < maxCacheEntries+10; i++ {
+		cache.set(fmt.Sprint(i), []byte("{}"), time.Duration(i+1)*time.Second, now)
+	}
+	assert.Equal(t, maxCacheEntries, cache.stats().Entries)
+
+	// The entries closest to expiring were dropped first
+	_, ok = cache.get("0", now)
+	assert.False(t, ok)
+	_, ok = cache.get(fmt.Sprint(maxCacheEntries+9), now)
+	assert.True(t, ok)
+}
@@ -0,0 +1,68 @@
+package dynatrace
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+)
+
+// ErrorCode classifies an error from the Client into one of the datatypes error codes
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErrorCode(apiErr)
+	}
+
+	var requestErr *RequestError
+	if errors.As(err, &requestErr) {
+		if errors.Is(err, context.Canceled) {
+			return datatypes.ErrorCodeCancelled
+		}
+
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return datatypes.ErrorCodeTimeout
+		}
+		return datatypes.ErrorCodeDynatraceUnreachable
+	}
+
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		return datatypes.ErrorCodeDynatraceError
+	}
+
+	return datatypes.ErrorCodeInternal
+}
+
+// apiErrorCode classifies the status code and message Dynatrace responded with
+func apiErrorCode(err *APIError) string {
+	switch {
+	case err.StatusCode == 401 || err.StatusCode == 403:
+		return datatypes.ErrorCodeAuthFailed
+	case err.StatusCode == 404:
+		return datatypes.ErrorCodeNotFound
+	case err.StatusCode == 429:
+		return datatypes.ErrorCodeRateLimited
+	case err.StatusCode >= 500:
+		return datatypes.ErrorCodeDynatraceError
+	case err.StatusCode == 400:
+		// Dynatrace lists the query parameters it rejected, so check which part of the query it complained about
+		for _, path := range err.violationPaths {
+			switch path {
+			case "metricSelector":
+				return datatypes.ErrorCodeInvalidMetricSelector
+			case "entitySelector", "entityId":
+				return datatypes.ErrorCodeNotFound
+			}
+		}
+		return datatypes.ErrorCodeInvalidRequest
+	}
+
+	return datatypes.ErrorCodeDynatraceError
+}
@@ -0,0 +1,114 @@
+package dynatrace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCode(t *testing.T) {
+	type testDefs struct {
+		Name         string
+		Err          error
+		ExpectedCode string
+	}
+
+	tests := []testDefs{
+		{
+			Name:         "No error",
+			Err:          nil,
+			ExpectedCode: "",
+		},
+		{
+			Name:         "Bad token",
+			Err:          newAPIError(401, []byte(`{"error":{"code":401,"message":"Token Authentication failed"}}`)),
+			ExpectedCode: datatypes.ErrorCodeAuthFailed,
+		},
+		{
+			Name:         "Missing permission",
+			Err:          newAPIError(403, []byte(`{"error":{"code":403,"message":"Token is missing required scope"}}`)),
+			ExpectedCode: datatypes.ErrorCodeAuthFailed,
+		},
+		{
+			Name:         "Invalid metric selector",
+			Err:          newAPIError(400, []byte(`{"error":{"code":400,"message":"Constraints violated.","constraintViolations":[{"path":"metricSelector","message":"Token 'foo' is not valid","parameterLocation":"QUERY"}]}}`)),
+			ExpectedCode: datatypes.ErrorCodeInvalidMetricSelector,
+		},
+		{
+			Name:         "Unknown entity",
+			Err:          newAPIError(400, []byte(`{"error":{"code":400,"message":"Constraints violated.","constraintViolations":[{"path":"entitySelector","message":"The entity selector is invalid","parameterLocation":"QUERY"}]}}`)),
+			ExpectedCode: datatypes.ErrorCodeNotFound,
+		},
+		{
+			Name:         "Other constraint violation",
+			Err:          newAPIError(400, []byte(`{"error":{"code":400,"message":"Constraints violated.","constraintViolations":[{"path":"from","message":"from must be before to","parameterLocation":"QUERY"}]}}`)),
+			ExpectedCode: datatypes.ErrorCodeInvalidRequest,
+		},
+		{
+			Name:         "Bad request mentioning a metric without naming the parameter",
+			Err:          newAPIError(400, []byte(`{"error":{"code":400,"message":"Metric selector parse error"}}`)),
+			ExpectedCode: datatypes.ErrorCodeInvalidRequest,
+		},
+		{
+			Name:         "Bad request without a body",
+			Err:          newAPIError(400, []byte(`<html>Bad Request</html>`)),
+			ExpectedCode: datatypes.ErrorCodeInvalidRequest,
+		},
+		{
+			Name:         "Not found",
+			Err:          newAPIError(404, nil),
+			ExpectedCode: datatypes.ErrorCodeNotFound,
+		},
+		{
+			Name:         "Rate limited",
+			Err:          newAPIError(429, nil),
+			ExpectedCode: datatypes.ErrorCodeRateLimited,
+		},
+		{
+			Name:         "Server error",
+			Err:          newAPIError(503, nil),
+			ExpectedCode: datatypes.ErrorCodeDynatraceError,
+		},
+		{
+			Name:         "Wrapped API error",
+			Err:          fmt.Errorf("error querying current metrics from Dynatrace: %w", newAPIError(401, nil)),
+			ExpectedCode: datatypes.ErrorCodeAuthFailed,
+		},
+		{
+			Name:         "Unreachable",
+			Err:          &RequestError{Err: errors.New("dial tcp: connection refused")},
+			ExpectedCode: datatypes.ErrorCodeDynatraceUnreachable,
+		},
+		{
+			Name:         "Cancelled",
+			Err:          &RequestError{Err: context.Canceled},
+			ExpectedCode: datatypes.ErrorCodeCancelled,
+		},
+		{
+			Name:         "Timed out",
+			Err:          &RequestError{Err: context.DeadlineExceeded},
+			ExpectedCode: datatypes.ErrorCodeTimeout,
+		},
+		{
+			Name:         "Unreadable response",
+			Err:          &DecodeError{Err: errors.New("unexpected end of JSON input")},
+			ExpectedCode: datatypes.ErrorCodeDynatraceError,
+		},
+		{
+			Name:         "Unknown error",
+			Err:          errors.New("something else"),
+			ExpectedCode: datatypes.ErrorCodeInternal,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert.Equal(t, test.ExpectedCode, ErrorCode(test.Err))
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package dynatrace
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/logging"
+)
+
+// defaultTimeoutSecs is used when the config does not set a request timeout
+const defaultTimeoutSecs = 10
+
+// Client sends requests to the Dynatrace APIs. A single Client is safe to share between requests and reuses its
+// connections
+type Client struct {
+	cache          *responseCache
+	descriptors    *descriptorCache
+	httpClient     *http.Client
+	maxRetries     int
+	retryBaseDelay time.Duration
+	tenants        map[string]*http.Client
+}
+
+// Environment identifies the Dynatrace tenant a request is sent to. Requests to a named Tenant use its CA and proxy
+// settings
+type Environment struct {
+	APIToken datatypes.Secret
+	Env      string
+	Server   string
+	Tenant   string
+}
+
+// EnvironmentFor returns the Dynatrace environment a performance signature queries
+func EnvironmentFor(ps datatypes.PerformanceSignature) Environment {
+	return Environment{
+		APIToken: ps.APIToken,
+		Env:      ps.DTEnv,
+		Server:   ps.DTServer,
+		Tenant:   ps.Tenant,
+	}
+}
+
+var (
+	defaultClient     *Client
+	defaultClientLock sync.RWMutex
+)
+
+func init() {
+	defaultClient, _ = NewClient(datatypes.Config{MaxRetries: DefaultMaxRetries})
+}
+
+// NewClient builds a Client with the timeout, proxy, and CA settings from the config. Each tenant gets its own
+// connections, using its proxy and CA settings or else the config's
+func NewClient(config datatypes.Config) (*Client, error) {
+	timeoutSecs := config.TimeoutSecs
+	if timeoutSecs < 1 {
+		timeoutSecs = defaultTimeoutSecs
+	}
+	timeout := time.Duration(timeoutSecs) * time.Second
+
+	transport, err := newTransport(config.Proxy, config.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tenants := map[string]*http.Client{}
+	for name, tenant := range config.Tenants {
+		proxy := tenant.Proxy
+		if proxy == "" {
+			proxy = config.Proxy
+		}
+
+		caFile := tenant.CAFile
+		if caFile == "" {
+			caFile = config.CAFile
+		}
+
+		tenantTransport, err := newTransport(proxy, caFile)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %v: %v", name, err)
+		}
+		tenants[name] = &http.Client{Timeout: timeout, Transport: tenantTransport}
+	}
+
+	return &Client{
+		cache:       newResponseCache(time.Duration(config.CacheTTLSecs)*time.Second, time.Duration(config.CachePastTTLSecs)*time.Second),
+		descriptors: newDescriptorCache(),
+		httpClient: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+		maxRetries:     config.MaxRetries,
+		retryBaseDelay: defaultRetryBaseDelay,
+		tenants:        tenants,
+	}, nil
+}
+
+// newTransport builds the transport for requests through the given proxy, trusting the CAs in caFile on top of the
+// system's
+func newTransport(proxy string, caFile string) (*http.Transport, error) {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			// The parse error quotes the URL, which may have a password in it
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			return nil, fmt.Errorf("could not parse the proxy URL: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the CA file: %v", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in the CA file %v", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return transport, nil
+}
+
+// httpClientFor returns the http.Client for requests to the environment's tenant
+func (c *Client) httpClientFor(env Environment) *http.Client {
+	if httpClient, ok := c.tenants[env.Tenant]; ok {
+		return httpClient
+	}
+	return c.httpClient
+}
+
+// NewClientWithHTTP builds a Client around an existing http.Client, with the default retry settings and no response
+// cache
+func NewClientWithHTTP(httpClient *http.Client) *Client {
+	return &Client{
+		cache:          newResponseCache(0, 0),
+		descriptors:    newDescriptorCache(),
+		httpClient:     httpClient,
+		maxRetries:     DefaultMaxRetries,
+		retryBaseDelay: defaultRetryBaseDelay,
+	}
+}
+
+// SetDefaultClient replaces the Client returned by DefaultClient
+func SetDefaultClient(client *Client) {
+	defaultClientLock.Lock()
+	defer defaultClientLock.Unlock()
+	defaultClient = client
+}
+
+// DefaultClient returns the Client configured at startup
+func DefaultClient() *Client {
+	defaultClientLock.RLock()
+	defer defaultClientLock.RUnlock()
+	return defaultClient
+}
+
+// buildURL builds the URL of an API path in the given environment
+func buildURL(env Environment, path string, query url.Values) string {
+	newURL := url.URL{
+		Scheme: "https",
+		Host:   env.Server,
+	}
+
+	// Check if there's a Dynatrace environment specified
+	if env.Env == "" {
+		newURL.Path = path
+	} else {
+		newURL.Path = fmt.Sprintf("/e/%v%v", env.Env, path)
+	}
+	newURL.RawQuery = query.Encode()
+
+	return newURL.String()
+}
+
+// do performs a request against the Dynatrace API and decodes the JSON response into out. Failures which may be
+// transient are retried with backoff
+func (c *Client) do(ctx context.Context, method string, env Environment, path string, query url.Values, body interface{}, out interface{}) error {
+	requestURL := buildURL(env, path, query)
+	logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Built URL: %v", requestURL)})
+
+	var reqBody []byte
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("could not encode the request body: %v", err)
+		}
+		reqBody = b
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := c.attempt(ctx, method, env, requestURL, reqBody, out)
+		if err == nil {
+			return nil
+		}
+
+		delay, retry := c.retryDelay(ctx, method, err, attempt)
+		if !retry {
+			return err
+		}
+
+		logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Retrying request to Dynatrace in %v after: %v", delay, err)})
+		if stats := retryStatsFrom(ctx); stats != nil {
+			stats.record(delay)
+		}
+
+		if Sleep(ctx, delay) != nil {
+			return err
+		}
+	}
+}
+
+// attempt performs a single request against the Dynatrace API
+func (c *Client) attempt(ctx context.Context, method string, env Environment, requestURL string, body []byte, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	// Build the request object
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, reqBody)
+	if err != nil {
+		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Error creating request handler: %v", err)})
+		return err
+	}
+
+	// Add the API token
+	req.Header.Add("Authorization", fmt.Sprintf("Api-Token %v", env.APIToken.Reveal()))
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	// Perform the request
+	r, err := c.httpClientFor(env).Do(req)
+	if err != nil {
+		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Error reaching Dynatrace: %v", err)})
+		return &RequestError{Err: err, notSent: notSent(err)}
+	}
+
+	// Read in the body
+	b, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Could not read response body from Dynatrace: %v", err.Error())})
+		return &RequestError{Err: fmt.Errorf("could not read response body from Dynatrace: %v", err.Error())}
+	}
+	logging.LogDebug(datatypes.Logging{Message: fmt.Sprintf("Full response from Dynatrace is: %v.", string(b))})
+
+	// Check the status code
+	if r.StatusCode != 200 {
+		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Invalid status code from Dynatrace: %v. Message is '%v'", r.StatusCode, string(b))})
+		apiErr := newAPIError(r.StatusCode, b)
+		apiErr.retryAfter = parseRetryAfter(r.Header, time.Now())
+		return apiErr
+	}
+
+	// Try to parse the response
+	err = json.Unmarshal(b, out)
+	if err != nil {
+		return &DecodeError{Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package dynatrace
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+)
+
+// metricsPath is the v2 Metrics API
+const metricsPath = "/api/v2/metrics/"
+
+// descriptorCacheTTL is how long a metric descriptor is reused. Descriptors rarely change, so this can be long
+const descriptorCacheTTL = time.Hour
+
+// descriptorCache holds the metric descriptors fetched from each environment
+type descriptorCache struct {
+	lock    sync.Mutex
+	entries map[string]descriptorCacheEntry
+}
+
+type descriptorCacheEntry struct {
+	descriptor datatypes.MetricDescriptor
+	expires    time.Time
+}
+
+func newDescriptorCache() *descriptorCache {
+	return &descriptorCache{entries: map[string]descriptorCacheEntry{}}
+}
+
+func (c *descriptorCache) get(key string, now time.Time) (datatypes.MetricDescriptor, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || now.After(entry.expires) {
+		delete(c.entries, key)
+		return datatypes.MetricDescriptor{}, false
+	}
+	return entry.descriptor, true
+}
+
+func (c *descriptorCache) set(key string, descriptor datatypes.MetricDescriptor, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[key] = descriptorCacheEntry{descriptor: descriptor, expires: now.Add(descriptorCacheTTL)}
+}
+
+// GetMetricDescriptor gets the descriptor of a metric key, reusing it if it was fetched recently
+func (c *Client) GetMetricDescriptor(ctx context.Context, env Environment, metricKey string) (datatypes.MetricDescriptor, error) {
+	// The token is part of the key, since tokens with different scopes may not see the same metrics
+	cacheKey := env.Server + "|" + env.Env + "|" + env.APIToken.Reveal() + "|" + metricKey
+	if descriptor, ok := c.descriptors.get(cacheKey, time.Now()); ok {
+		return descriptor, nil
+	}
+
+	var descriptor datatypes.MetricDescriptor
+	err := c.do(ctx, "GET", env, metricsPath+metricKey, url.Values{}, nil, &descriptor)
+	if err != nil {
+		return datatypes.MetricDescriptor{}, err
+	}
+
+	c.descriptors.set(cacheKey, descriptor, time.Now())
+	return descriptor, nil
+}
@@ -0,0 +1,67 @@
+package dynatrace
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMetricDescriptor(t *testing.T) {
+	requests := 0
+	server, client, env := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/api/v2/metrics/builtin:service.response.time", r.URL.Path)
+		w.Write([]byte(`{"metricId":"builtin:service.response.time","displayName":"Response time","unit":"MicroSecond","aggregationTypes":["auto","avg","max","min","percentile"]}`))
+	})
+	defer server.Close()
+
+	expected := datatypes.MetricDescriptor{
+		MetricID:         "builtin:service.response.time",
+		DisplayName:      "Response time",
+		Unit:             "MicroSecond",
+		AggregationTypes: []string{"auto", "avg", "max", "min", "percentile"},
+	}
+
+	descriptor, err := client.GetMetricDescriptor(context.Background(), env, "builtin:service.response.time")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, descriptor)
+
+	// The second lookup is served from the cache
+	descriptor, err = client.GetMetricDescriptor(context.Background(), env, "builtin:service.response.time")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, descriptor)
+	assert.Equal(t, 1, requests)
+}
+
+func TestGetMetricDescriptorNotFound(t *testing.T) {
+	server, client, env := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		w.Write([]byte(`{"error":{"code":404,"message":"Metric key not found"}}`))
+	})
+	defer server.Close()
+
+	_, err := client.GetMetricDescriptor(context.Background(), env, "builtin:does.not.exist")
+
+	assert.EqualError(t, err, "invalid status code from Dynatrace: 404 (Metric key not found)")
+}
+
+func TestDescriptorCache(t *testing.T) {
+	cache := newDescriptorCache()
+	now := time.Now()
+	cache.set("key", datatypes.MetricDescriptor{MetricID: "key"}, now)
+
+	descriptor, ok := cache.get("key", now.Add(time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, "key", descriptor.MetricID)
+
+	_, ok = cache.get("key", now.Add(descriptorCacheTTL+time.Second))
+	assert.False(t, ok)
+
+	_, ok = cache.get("other", now)
+	assert.False(t, ok)
+}
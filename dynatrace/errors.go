@@ -0,0 +1,87 @@
+package dynatrace
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// APIError is returned when Dynatrace responds with a status code other than 200
+type APIError struct {
+	StatusCode int
+	Message    string
+	Body       string
+
+	// retryAfter is how long Dynatrace asked us to wait before trying again, if it said
+	retryAfter time.Duration
+
+	// violationPaths are the request parameters Dynatrace said were invalid, such as metricSelector
+	violationPaths []string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("invalid status code from Dynatrace: %v", e.StatusCode)
+	}
+	return fmt.Sprintf("invalid status code from Dynatrace: %v (%v)", e.StatusCode, e.Message)
+}
+
+// RequestError is returned when Dynatrace could not be reached or its response could not be read
+type RequestError struct {
+	Err error
+
+	// notSent is set when the connection failed before the request could reach Dynatrace
+	notSent bool
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying transport error
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError is returned when the response from Dynatrace could not be parsed
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("could not parse the response from Dynatrace: %v", e.Err)
+}
+
+// Unwrap returns the underlying JSON error
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// errorResponse is the body Dynatrace sends with most errors
+type errorResponse struct {
+	Error struct {
+		Code                 int    `json:"code"`
+		Message              string `json:"message"`
+		ConstraintViolations []struct {
+			Path    string `json:"path"`
+			Message string `json:"message"`
+		} `json:"constraintViolations"`
+	} `json:"error"`
+}
+
+// newAPIError builds an APIError, pulling the message out of the body when Dynatrace sent one
+func newAPIError(statusCode int, body []byte) *APIError {
+	var parsed errorResponse
+	json.Unmarshal(body, &parsed)
+
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Message:    parsed.Error.Message,
+		Body:       string(body),
+	}
+	for _, violation := range parsed.Error.ConstraintViolations {
+		apiErr.violationPaths = append(apiErr.violationPaths, violation.Path)
+	}
+
+	return apiErr
+}
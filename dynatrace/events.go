@@ -0,0 +1,82 @@
+package dynatrace
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+)
+
+// eventsPath is the v1 Events API
+const eventsPath = "/api/v1/events"
+
+// GetDeploymentEvents gets the Deployment Events of a service. A from of 0 uses the Dynatrace default timeframe. They
+// are cached for at most eventsCacheTTL, and until a deployment of the service is pushed through the Client
+func (c *Client) GetDeploymentEvents(ctx context.Context, env Environment, serviceID string, from int) (datatypes.DeploymentEvents, error) {
+	ttl := c.cache.ttl
+	if ttl > eventsCacheTTL {
+		ttl = eventsCacheTTL
+	}
+
+	var deploymentEvents datatypes.DeploymentEvents
+	var err error
+	if ttl > 0 {
+		err = c.cachedGetFor(ctx, env, eventsPath, deploymentEventsQuery(serviceID, from), ttl, &deploymentEvents)
+	} else {
+		err = c.do(ctx, "GET", env, eventsPath, deploymentEventsQuery(serviceID, from), nil, &deploymentEvents)
+	}
+	if err != nil {
+		return datatypes.DeploymentEvents{}, err
+	}
+
+	return deploymentEvents, nil
+}
+
+// PushDeploymentEvent stores a Deployment Event in Dynatrace. The cached Deployment Events of its services are
+// dropped, so the next evaluation sees it
+func (c *Client) PushDeploymentEvent(ctx context.Context, env Environment, event datatypes.DeploymentEventPush) (datatypes.EventStoreResult, error) {
+	var result datatypes.EventStoreResult
+	err := c.do(ctx, "POST", env, eventsPath, url.Values{}, event, &result)
+
+	// Even a failed push may have been stored
+	for _, serviceID := range event.AttachRules.EntityIds {
+		c.forgetDeploymentEvents(env, serviceID)
+	}
+
+	if err != nil {
+		return datatypes.EventStoreResult{}, err
+	}
+
+	return result, nil
+}
+
+// forgetDeploymentEvents drops the cached Deployment Events of a service, whichever token fetched them
+func (c *Client) forgetDeploymentEvents(env Environment, serviceID string) {
+	prefix := env.Server + "|" + env.Env + "|"
+	c.cache.forget(func(key string) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+
+		parts := strings.SplitN(key, "|"+eventsPath+"?", 2)
+		if len(parts) != 2 {
+			return false
+		}
+		query, err := url.ParseQuery(parts[1])
+		return err == nil && query.Get("entityId") == serviceID
+	})
+}
+
+// deploymentEventsQuery builds the query for the Deployment Events of a service
+func deploymentEventsQuery(serviceID string, from int) url.Values {
+	q := url.Values{}
+	q.Set("eventType", "CUSTOM_DEPLOYMENT")
+	q.Set("entityId", serviceID)
+	if from != 0 {
+		q.Set("from", fmt.Sprint(from))
+	}
+
+	return q
+}
@@ -0,0 +1,141 @@
+package dynatrace
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDeploymentEvents(t *testing.T) {
+	server, client, env := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/events", r.URL.Path)
+		assert.Equal(t, "entityId=SERVICE-1234&eventType=CUSTOM_DEPLOYMENT&from=1598818148", r.URL.RawQuery)
+		w.Write([]byte(`{"events":[{"startTime":1234,"endTime":2345}]}`))
+	})
+	defer server.Close()
+
+	events, err := client.GetDeploymentEvents(context.Background(), env, "SERVICE-1234", 1598818148)
+
+	assert.NoError(t, err)
+	assert.Equal(t, datatypes.GetSingleEventDeploymentEvent(), events)
+}
+
+func TestGetDeploymentEventsCached(t *testing.T) {
+	requests := 0
+	server, client, env := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			w.Write([]byte(`{"storedEventIds":[1]}`))
+			return
+		}
+		requests++
+		w.Write([]byte(`{"events":[]}`))
+	})
+	defer server.Close()
+	client.cache = newResponseCache(time.Minute, time.Hour)
+
+	client.GetDeploymentEvents(context.Background(), env, "SERVICE-1234", 0)
+	client.GetDeploymentEvents(context.Background(), env, "SERVICE-1234", 0)
+	client.GetDeploymentEvents(context.Background(), env, "SERVICE-5678", 0)
+	assert.Equal(t, 2, requests)
+
+	// Pushing a deployment of a service drops only its events
+	_, err := client.PushDeploymentEvent(context.Background(), env, datatypes.DeploymentEventPush{AttachRules: datatypes.AttachRules{EntityIds: []string{"SERVICE-1234"}}})
+	assert.NoError(t, err)
+	client.GetDeploymentEvents(context.Background(), env, "SERVICE-1234", 0)
+	client.GetDeploymentEvents(context.Background(), env, "SERVICE-5678", 0)
+	assert.Equal(t, 3, requests)
+
+	// Events are kept for eventsCacheTTL at most
+	client.cache.lock.Lock()
+	for key, entry := range client.cache.entries {
+		assert.True(t, time.Until(entry.expires) <= eventsCacheTTL, key)
+	}
+	client.cache.lock.Unlock()
+
+	// Without a cache, they are always fetched
+	client.cache = newResponseCache(0, time.Hour)
+	client.GetDeploymentEvents(context.Background(), env, "SERVICE-1234", 0)
+	client.GetDeploymentEvents(context.Background(), env, "SERVICE-1234", 0)
+	assert.Equal(t, 5, requests)
+}
+
+func TestDeploymentEventsQuery(t *testing.T) {
+	assert.Equal(t, "entityId=asdf&eventType=CUSTOM_DEPLOYMENT", deploymentEventsQuery("asdf", 0).Encode())
+	assert.Equal(t, "entityId=asdf&eventType=CUSTOM_DEPLOYMENT&from=10234", deploymentEventsQuery("asdf", 10234).Encode())
+}
+
+func TestPushDeploymentEvent(t *testing.T) {
+	type testDefs struct {
+		Name           string
+		StatusCode     int
+		Body           string
+		ExpectPass     bool
+		ExpectedError  string
+		ExpectedResult datatypes.EventStoreResult
+	}
+
+	tests := []testDefs{
+		{
+			Name:       "Pass - event stored",
+			StatusCode: 200,
+			Body:       `{"storedEventIds":[1234],"storedIds":["1234_5678"],"storedCorrelationIds":["abcd"]}`,
+			ExpectPass: true,
+			ExpectedResult: datatypes.EventStoreResult{
+				StoredEventIds:       []int64{1234},
+				StoredIds:            []string{"1234_5678"},
+				StoredCorrelationIds: []string{"abcd"},
+			},
+		},
+		{
+			Name:          "Fail - bad token",
+			StatusCode:    401,
+			Body:          `{"error":{"code":401,"message":"Token Authentication failed"}}`,
+			ExpectPass:    false,
+			ExpectedError: "invalid status code from Dynatrace: 401 (Token Authentication failed)",
+		},
+	}
+
+	event := datatypes.DeploymentEventPush{
+		EventType: "CUSTOM_DEPLOYMENT",
+		AttachRules: datatypes.AttachRules{
+			EntityIds: []string{"SERVICE-1234"},
+		},
+		DeploymentName:    "Deploy checkout",
+		DeploymentVersion: "1.2.3",
+		Source:            "goDynaPerfSignature",
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			server, client, env := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "POST", r.Method)
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+				b, _ := ioutil.ReadAll(r.Body)
+				var received datatypes.DeploymentEventPush
+				json.Unmarshal(b, &received)
+				assert.Equal(t, event, received)
+
+				w.WriteHeader(test.StatusCode)
+				w.Write([]byte(test.Body))
+			})
+			defer server.Close()
+
+			result, err := client.PushDeploymentEvent(context.Background(), env, event)
+
+			if test.ExpectPass == true {
+				assert.NoError(t, err)
+				assert.Equal(t, test.ExpectedResult, result)
+			} else {
+				assert.EqualError(t, err, test.ExpectedError)
+			}
+		})
+	}
+}
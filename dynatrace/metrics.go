@@ -0,0 +1,50 @@
+package dynatrace
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+)
+
+// metricsQueryPath is the v2 Metrics API query endpoint
+const metricsQueryPath = "/api/v2/metrics/query"
+
+// MetricsQuery defines a query against the v2 Metrics API
+type MetricsQuery struct {
+	MetricSelector string
+	EntityID       string
+	From           int64
+	To             int64
+
+	// Resolution is how far apart the returned data points are. Inf, the default, returns a single point
+	Resolution string
+}
+
+// QueryMetrics queries the v2 Metrics API
+func (c *Client) QueryMetrics(ctx context.Context, env Environment, query MetricsQuery) (datatypes.DynatraceMetricsResponse, error) {
+	var metricsResponse datatypes.DynatraceMetricsResponse
+	err := c.cachedGet(ctx, env, metricsQueryPath, metricsQueryValues(query), query.To, &metricsResponse)
+	if err != nil {
+		return datatypes.DynatraceMetricsResponse{}, err
+	}
+
+	return metricsResponse, nil
+}
+
+// metricsQueryValues builds the URL query of a MetricsQuery
+func metricsQueryValues(query MetricsQuery) url.Values {
+	q := url.Values{}
+	q.Set("metricSelector", query.MetricSelector)
+	resolution := query.Resolution
+	if resolution == "" {
+		resolution = "Inf"
+	}
+	q.Set("resolution", resolution)
+	q.Set("from", fmt.Sprint(query.From))
+	q.Set("to", fmt.Sprint(query.To))
+	q.Set("entitySelector", fmt.Sprintf("entityId(\"%v\")", query.EntityID))
+
+	return q
+}
@@ -0,0 +1,52 @@
+package dynatrace
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsQueryValues(t *testing.T) {
+	query := MetricsQuery{
+		MetricSelector: "builtin:service.response.time:(avg),builtin:service.errors.total.rate:(avg)",
+		EntityID:       "asdf",
+		From:           1234,
+		To:             2345,
+	}
+
+	assert.Equal(t, "entitySelector=entityId%28%22asdf%22%29&from=1234&metricSelector=builtin%3Aservice.response.time%3A%28avg%29%2Cbuiltin%3Aservice.errors.total.rate%3A%28avg%29&resolution=Inf&to=2345", metricsQueryValues(query).Encode())
+
+	query.Resolution = "1m"
+	assert.Equal(t, "1m", metricsQueryValues(query).Get("resolution"))
+}
+
+func TestQueryMetrics(t *testing.T) {
+	server, client, env := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/e/env1234/api/v2/metrics/query", r.URL.Path)
+		w.Write([]byte(`{"result":[{"metricId":"dummy_metric_name:avg","data":[{"dimensions":["dim1"],"timestamps":[1234],"values":[1234.1234]}]}]}`))
+	})
+	defer server.Close()
+	env.Env = "env1234"
+
+	response, err := client.QueryMetrics(context.Background(), env, MetricsQuery{MetricSelector: "dummy_metric_name:avg", EntityID: "asdf", From: 1234, To: 2345})
+
+	assert.NoError(t, err)
+	assert.Equal(t, datatypes.GetValidPassingComparisonMetrics().CurrentMetrics, response)
+}
+
+func TestQueryMetricsMissingPoints(t *testing.T) {
+	server, client, env := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result":[{"metricId":"dummy_metric_name:avg","data":[{"dimensions":["dim1"],"timestamps":[1000,2000,3000],"values":[12.5,null,20]}]}]}`))
+	})
+	defer server.Close()
+
+	response, err := client.QueryMetrics(context.Background(), env, MetricsQuery{MetricSelector: "dummy_metric_name:avg", EntityID: "asdf", From: 1000, To: 4000, Resolution: "1m"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1000, 3000}, response.Metrics[0].MetricValues[0].Timestamps)
+	assert.Equal(t, []float64{12.5, 20}, response.Metrics[0].MetricValues[0].Values)
+}
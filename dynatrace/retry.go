@@ -0,0 +1,152 @@
+package dynatrace
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxRetries is how many times a failed request is retried unless the config says otherwise
+	DefaultMaxRetries = 3
+
+	// defaultRetryBaseDelay is the backoff before the first retry. It doubles with every retry after that
+	defaultRetryBaseDelay = 500 * time.Millisecond
+
+	// maxRetryDelay is the longest we will wait before a retry. If Dynatrace asks for longer, we give up
+	maxRetryDelay = 60 * time.Second
+)
+
+// RetryStats counts the retries made while serving a single evaluation
+type RetryStats struct {
+	lock    sync.Mutex
+	retries int
+	wait    time.Duration
+}
+
+// Retries returns the number of retries made so far
+func (s *RetryStats) Retries() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.retries
+}
+
+// Wait returns the total time spent waiting between retries so far
+func (s *RetryStats) Wait() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.wait
+}
+
+func (s *RetryStats) record(wait time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.retries++
+	s.wait += wait
+}
+
+type retryStatsKey struct{}
+
+// WithRetryStats returns a context which collects the retries of every request made with it
+func WithRetryStats(ctx context.Context) (context.Context, *RetryStats) {
+	stats := &RetryStats{}
+	return context.WithValue(ctx, retryStatsKey{}, stats), stats
+}
+
+// retryStatsFrom returns the RetryStats of a context, or nil if it isn't collecting them
+func retryStatsFrom(ctx context.Context) *RetryStats {
+	stats, _ := ctx.Value(retryStatsKey{}).(*RetryStats)
+	return stats
+}
+
+// retryDelay decides whether a failed request should be retried and how long to wait first. Only GETs are retried
+// whenever the failure may be transient. Other methods are only retried when Dynatrace can't have acted on the request
+// yet, so a POST which timed out after Dynatrace stored its event doesn't store it twice
+func (c *Client) retryDelay(ctx context.Context, method string, err error, attempt int) (time.Duration, bool) {
+	if attempt >= c.maxRetries || ctx.Err() != nil {
+		return 0, false
+	}
+	idempotent := method == http.MethodGet
+
+	switch e := err.(type) {
+	case *RequestError:
+		if !idempotent && !e.notSent {
+			return 0, false
+		}
+		return c.backoff(attempt), true
+	case *APIError:
+		if e.StatusCode != http.StatusTooManyRequests && (e.StatusCode < 500 || !idempotent) {
+			return 0, false
+		}
+
+		// Dynatrace tells us when its rate limit resets, so wait exactly that long
+		if e.retryAfter > 0 {
+			return e.retryAfter, e.retryAfter <= maxRetryDelay
+		}
+		return c.backoff(attempt), true
+	}
+
+	return 0, false
+}
+
+// notSent checks whether a transport error happened before the request was written, such as failing to resolve or
+// connect to Dynatrace
+func notSent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// backoff returns an exponential delay for the attempt with jitter, so concurrent queries don't retry in lockstep
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.retryBaseDelay << uint(attempt)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// parseRetryAfter reads how long Dynatrace asked us to wait from the Retry-After or X-RateLimit-Reset headers
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if retryAfter := header.Get("Retry-After"); retryAfter != "" {
+		if secs, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Duration(secs) * time.Second
+		}
+		if t, err := http.ParseTime(retryAfter); err == nil {
+			return t.Sub(now)
+		}
+	}
+
+	// Dynatrace sends the reset time in microseconds since the epoch
+	if reset := header.Get("X-RateLimit-Reset"); reset != "" {
+		if micros, err := strconv.ParseInt(reset, 10, 64); err == nil {
+			return time.Unix(0, micros*int64(time.Microsecond)).Sub(now)
+		}
+	}
+
+	return 0
+}
+
+// Sleep waits for the delay, returning early with an error if the context is cancelled
+func Sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
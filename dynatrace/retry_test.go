@@ -0,0 +1,178 @@
+package dynatrace
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	type testDefs struct {
+		Name           string
+		Header         http.Header
+		ExpectedResult time.Duration
+	}
+
+	now := time.Unix(1600000000, 0)
+
+	tests := []testDefs{
+		{
+			Name:           "No headers",
+			Header:         http.Header{},
+			ExpectedResult: 0,
+		},
+		{
+			Name:           "Retry-After seconds",
+			Header:         http.Header{"Retry-After": []string{"5"}},
+			ExpectedResult: 5 * time.Second,
+		},
+		{
+			Name:           "Retry-After date",
+			Header:         http.Header{"Retry-After": []string{now.Add(30 * time.Second).UTC().Format(http.TimeFormat)}},
+			ExpectedResult: 30 * time.Second,
+		},
+		{
+			Name:           "X-RateLimit-Reset microseconds",
+			Header:         http.Header{"X-Ratelimit-Reset": []string{"1600000002000000"}},
+			ExpectedResult: 2 * time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert.Equal(t, test.ExpectedResult, parseRetryAfter(test.Header, now))
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	client := &Client{retryBaseDelay: 100 * time.Millisecond}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		full := 100 * time.Millisecond << uint(attempt)
+		delay := client.backoff(attempt)
+		assert.True(t, delay >= full/2 && delay <= full, "attempt %v waited %v", attempt, delay)
+	}
+
+	assert.True(t, client.backoff(30) <= maxRetryDelay)
+}
+
+func TestRetries(t *testing.T) {
+	type testDefs struct {
+		Name            string
+		Method          string
+		StatusCodes     []int
+		Header          http.Header
+		ExpectPass      bool
+		ExpectedRetries int
+		ExpectedCalls   int
+	}
+
+	tests := []testDefs{
+		{
+			Name:            "Pass - recovers from a 503",
+			StatusCodes:     []int{503, 200},
+			ExpectPass:      true,
+			ExpectedRetries: 1,
+			ExpectedCalls:   2,
+		},
+		{
+			Name:            "Pass - waits out a rate limit",
+			StatusCodes:     []int{429, 429, 200},
+			Header:          http.Header{"Retry-After": []string{"0"}},
+			ExpectPass:      true,
+			ExpectedRetries: 2,
+			ExpectedCalls:   3,
+		},
+		{
+			Name:            "Fail - gives up after the max retries",
+			StatusCodes:     []int{500, 500, 500, 500, 500},
+			ExpectPass:      false,
+			ExpectedRetries: 3,
+			ExpectedCalls:   4,
+		},
+		{
+			Name:            "Fail - rate limit resets too far away",
+			StatusCodes:     []int{429, 200},
+			Header:          http.Header{"Retry-After": []string{"3600"}},
+			ExpectPass:      false,
+			ExpectedRetries: 0,
+			ExpectedCalls:   1,
+		},
+		{
+			Name:            "Pass - POST waits out a rate limit",
+			Method:          "POST",
+			StatusCodes:     []int{429, 200},
+			Header:          http.Header{"Retry-After": []string{"0"}},
+			ExpectPass:      true,
+			ExpectedRetries: 1,
+			ExpectedCalls:   2,
+		},
+		{
+			Name:            "Fail - POST is not retried after a 503",
+			Method:          "POST",
+			StatusCodes:     []int{503, 200},
+			ExpectPass:      false,
+			ExpectedRetries: 0,
+			ExpectedCalls:   1,
+		},
+		{
+			Name:            "Fail - bad request is not retried",
+			StatusCodes:     []int{400, 200},
+			ExpectPass:      false,
+			ExpectedRetries: 0,
+			ExpectedCalls:   1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			calls := 0
+			server, client, env := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+				for key, values := range test.Header {
+					w.Header()[key] = values
+				}
+				w.WriteHeader(test.StatusCodes[calls])
+				w.Write([]byte(`{"events":[]}`))
+				calls++
+			})
+			defer server.Close()
+			client.retryBaseDelay = time.Millisecond
+
+			method := test.Method
+			if method == "" {
+				method = "GET"
+			}
+
+			ctx, stats := WithRetryStats(context.Background())
+			var out datatypes.DeploymentEvents
+			err := client.do(ctx, method, env, eventsPath, url.Values{}, nil, &out)
+
+			if test.ExpectPass == true {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+			assert.Equal(t, test.ExpectedRetries, stats.Retries())
+			assert.Equal(t, test.ExpectedCalls, calls)
+		})
+	}
+}
+
+func TestRetriesUnsentPost(t *testing.T) {
+	client, _ := NewClient(datatypes.Config{MaxRetries: 2})
+	client.retryBaseDelay = time.Millisecond
+
+	ctx, stats := WithRetryStats(context.Background())
+	var out datatypes.EventStoreResult
+	err := client.do(ctx, "POST", Environment{Server: "127.0.0.1:1"}, eventsPath, url.Values{}, datatypes.DeploymentEventPush{}, &out)
+
+	assert.IsType(t, &RequestError{}, err)
+	assert.Equal(t, 2, stats.Retries())
+}
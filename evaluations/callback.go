@@ -0,0 +1,140 @@
+package evaluations
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/dynatrace"
+	"github.com/barrebre/goDynaPerfSignature/logging"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 of the callback body, keyed with the CallbackSecret
+	SignatureHeader = "X-Signature-256"
+
+	// EvaluationIDHeader carries the ID of the job a callback belongs to
+	EvaluationIDHeader = "X-Evaluation-ID"
+
+	// maxCallbackAttempts is how many times a result is sent before its delivery is given up on
+	maxCallbackAttempts = 5
+
+	// callbackTimeout bounds how long a single delivery can take
+	callbackTimeout = 10 * time.Second
+
+	// maxCallbackDelay is the longest we wait between deliveries
+	maxCallbackDelay = time.Minute
+)
+
+// callbackBaseDelay is the backoff before the first retry of a delivery. It doubles with every retry after that
+var callbackBaseDelay = 2 * time.Second
+
+// deliverCallback POSTs the result of a finished job to its CallbackURL, retrying transient failures with backoff.
+// The progress is recorded on the job, so it can be checked with Get
+func (q *Queue) deliverCallback(j *job, result datatypes.PerformanceSignatureReturn) {
+	body, err := json.Marshal(result)
+	if err != nil {
+		q.recordCallback(j, datatypes.CallbackStatusFailed, 0, 0, fmt.Sprintf("could not marshal the result: %v", err))
+		return
+	}
+
+	for attempt := 1; attempt <= maxCallbackAttempts; attempt++ {
+		statusCode, err := q.postCallback(j.status.ID, j.ps.CallbackURL, j.ps.CallbackSecret.Reveal(), body)
+		if err == nil {
+			q.recordCallback(j, datatypes.CallbackStatusDelivered, attempt, statusCode, "")
+			logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Delivered the result of evaluation %v to its callback", j.status.ID)})
+			return
+		}
+
+		if !retryableCallback(statusCode) || errors.Is(err, errPrivateAddress) || attempt == maxCallbackAttempts {
+			q.recordCallback(j, datatypes.CallbackStatusFailed, attempt, statusCode, err.Error())
+			logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Could not deliver the result of evaluation %v to its callback after %v attempts: %v", j.status.ID, attempt, err)})
+			return
+		}
+		q.recordCallback(j, datatypes.CallbackStatusPending, attempt, statusCode, err.Error())
+
+		if err := dynatrace.Sleep(q.ctx, callbackBackoff(attempt)); err != nil {
+			q.recordCallback(j, datatypes.CallbackStatusFailed, attempt, statusCode, fmt.Sprintf("stopped retrying: %v", err))
+			return
+		}
+	}
+}
+
+// postCallback makes a single delivery. A non-2xx response is returned as an error along with its status code
+func (q *Queue) postCallback(id string, callbackURL string, secret string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(q.ctx, callbackTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EvaluationIDHeader, id)
+	if secret != "" {
+		req.Header.Set(SignatureHeader, Sign(secret, body))
+	}
+
+	resp, err := q.callbackClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("the callback responded with %v", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// recordCallback replaces the job's delivery status. It is replaced instead of modified, so copies handed out by Get
+// never change underneath their holders
+func (q *Queue) recordCallback(j *job, status string, attempts int, statusCode int, lastError string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	delivery := &datatypes.CallbackDelivery{
+		URL:            j.ps.CallbackURL,
+		Status:         status,
+		Attempts:       attempts,
+		LastStatusCode: statusCode,
+		LastError:      lastError,
+	}
+	if status == datatypes.CallbackStatusDelivered {
+		now := time.Now()
+		delivery.DeliveredAt = &now
+	}
+	j.status.Callback = delivery
+}
+
+// Sign returns the value of the SignatureHeader for a body, so receivers can check it came from us
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryableCallback checks whether a failed delivery might succeed later. Connection failures have no status code
+func retryableCallback(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// callbackBackoff returns the exponential delay after a failed attempt
+func callbackBackoff(attempt int) time.Duration {
+	delay := callbackBaseDelay << uint(attempt-1)
+	if delay <= 0 || delay > maxCallbackDelay {
+		delay = maxCallbackDelay
+	}
+	return delay
+}
@@ -0,0 +1,199 @@
+package evaluations
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/stretchr/testify/assert"
+)
+
+// waitForCallback polls a job until its callback reaches the status, failing the test if it takes too long
+func waitForCallback(t *testing.T, q *Queue, id string, status string) datatypes.CallbackDelivery {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := q.Get(id)
+		if ok && job.Callback != nil && job.Callback.Status == status {
+			return *job.Callback
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("the callback of job %v never became %v", id, status)
+	return datatypes.CallbackDelivery{}
+}
+
+func TestCallbackDelivery(t *testing.T) {
+	type testDefs struct {
+		Name             string
+		Secret           string
+		Responses        []int
+		ExpectedStatus   string
+		ExpectedAttempts int
+		ExpectedCode     int
+	}
+
+	tests := []testDefs{
+		{
+			Name:             "Delivered with a signature",
+			Secret:           "s3cret",
+			Responses:        []int{200},
+			ExpectedStatus:   datatypes.CallbackStatusDelivered,
+			ExpectedAttempts: 1,
+			ExpectedCode:     200,
+		},
+		{
+			Name:             "Delivered without a signature",
+			Responses:        []int{204},
+			ExpectedStatus:   datatypes.CallbackStatusDelivered,
+			ExpectedAttempts: 1,
+			ExpectedCode:     204,
+		},
+		{
+			Name:             "Retried after server errors",
+			Secret:           "s3cret",
+			Responses:        []int{500, 503, 200},
+			ExpectedStatus:   datatypes.CallbackStatusDelivered,
+			ExpectedAttempts: 3,
+			ExpectedCode:     200,
+		},
+		{
+			Name:             "Rejected callbacks aren't retried",
+			Responses:        []int{400},
+			ExpectedStatus:   datatypes.CallbackStatusFailed,
+			ExpectedAttempts: 1,
+			ExpectedCode:     400,
+		},
+		{
+			Name:             "Gives up after too many failures",
+			Responses:        []int{500, 500, 500, 500, 500, 500},
+			ExpectedStatus:   datatypes.CallbackStatusFailed,
+			ExpectedAttempts: maxCallbackAttempts,
+			ExpectedCode:     500,
+		},
+	}
+
+	previousDelay := callbackBaseDelay
+	callbackBaseDelay = time.Millisecond
+	defer func() { callbackBaseDelay = previousDelay }()
+
+	// The test servers listen on loopback, which has to be allowed explicitly
+	SetCallbackAllowedHosts([]string{"127.0.0.1"})
+	defer SetCallbackAllowedHosts(nil)
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var calls int32
+			var evaluationID atomic.Value
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				if test.Secret != "" {
+					assert.Equal(t, Sign(test.Secret, body), r.Header.Get(SignatureHeader))
+				} else {
+					assert.Empty(t, r.Header.Get(SignatureHeader))
+				}
+				assert.JSONEq(t, `{"Error":false,"Pass":true,"Response":["Looks good"]}`, string(body))
+				evaluationID.Store(r.Header.Get(EvaluationIDHeader))
+
+				call := atomic.AddInt32(&calls, 1)
+				w.WriteHeader(test.Responses[call-1])
+			}))
+			defer server.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			q := NewQueue(ctx, 1, func(ctx context.Context, ps datatypes.PerformanceSignature) datatypes.PerformanceSignatureReturn {
+				return datatypes.PerformanceSignatureReturn{Pass: true, Response: []string{"Looks good"}}
+			})
+
+			ps := datatypes.GetValidStaticPerformanceSignature()
+			ps.CallbackURL = server.URL
+			ps.CallbackSecret = datatypes.Secret(test.Secret)
+			job, err := q.Submit(ps)
+			assert.NoError(t, err)
+
+			delivery := waitForCallback(t, q, job.ID, test.ExpectedStatus)
+			assert.Equal(t, server.URL, delivery.URL)
+			assert.Equal(t, test.ExpectedAttempts, delivery.Attempts)
+			assert.Equal(t, test.ExpectedCode, delivery.LastStatusCode)
+			assert.Equal(t, int32(test.ExpectedAttempts), atomic.LoadInt32(&calls))
+			assert.Equal(t, job.ID, evaluationID.Load())
+			if test.ExpectedStatus == datatypes.CallbackStatusDelivered {
+				assert.NotNil(t, delivery.DeliveredAt)
+				assert.Empty(t, delivery.LastError)
+			} else {
+				assert.Nil(t, delivery.DeliveredAt)
+				assert.NotEmpty(t, delivery.LastError)
+			}
+		})
+	}
+}
+
+func TestCallbackUnreachable(t *testing.T) {
+	previousDelay := callbackBaseDelay
+	callbackBaseDelay = time.Millisecond
+	defer func() { callbackBaseDelay = previousDelay }()
+
+	SetCallbackAllowedHosts([]string{"127.0.0.1"})
+	defer SetCallbackAllowedHosts(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewQueue(ctx, 1, func(ctx context.Context, ps datatypes.PerformanceSignature) datatypes.PerformanceSignatureReturn {
+		return datatypes.PerformanceSignatureReturn{Pass: true}
+	})
+
+	// Nothing listens on port 1, so every delivery fails
+	ps := datatypes.GetValidStaticPerformanceSignature()
+	ps.CallbackURL = "http://127.0.0.1:1/hook"
+	job, err := q.Submit(ps)
+	assert.NoError(t, err)
+
+	delivery := waitForCallback(t, q, job.ID, datatypes.CallbackStatusFailed)
+	assert.Equal(t, maxCallbackAttempts, delivery.Attempts)
+	assert.Equal(t, 0, delivery.LastStatusCode)
+}
+
+func TestCallbackPrivateAddress(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewQueue(ctx, 1, func(ctx context.Context, ps datatypes.PerformanceSignature) datatypes.PerformanceSignatureReturn {
+		return datatypes.PerformanceSignatureReturn{Pass: true}
+	})
+
+	// localhost resolves to loopback, so the delivery is refused once, without ever reaching the server
+	ps := datatypes.GetValidStaticPerformanceSignature()
+	ps.CallbackURL = strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	job, err := q.Submit(ps)
+	assert.NoError(t, err)
+
+	delivery := waitForCallback(t, q, job.ID, datatypes.CallbackStatusFailed)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Contains(t, delivery.LastError, errPrivateAddress.Error())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
+
+func TestSign(t *testing.T) {
+	// Computed with: printf '{"Pass":true}' | openssl dgst -sha256 -hmac s3cret
+	assert.Equal(t, "sha256=e86ec80e97bf86258e6648a198fde56c8f58200137f786b80a8f6952a8bbe3ef", Sign("s3cret", []byte(`{"Pass":true}`)))
+}
+
+func TestCallbackBackoff(t *testing.T) {
+	assert.Equal(t, callbackBaseDelay, callbackBackoff(1))
+	assert.Equal(t, 4*callbackBaseDelay, callbackBackoff(3))
+	assert.Equal(t, maxCallbackDelay, callbackBackoff(10))
+}
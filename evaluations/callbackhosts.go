@@ -0,0 +1,129 @@
+package evaluations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// errPrivateAddress is returned when a callback would be sent to an address inside the network goDynaPerfSignature
+// runs in, such as a cloud metadata endpoint
+var errPrivateAddress = errors.New("callbacks can't be sent to loopback, link-local or private addresses")
+
+// privateNetworks are the ranges, besides loopback and link-local, which callbacks are refused for
+var privateNetworks = parseNetworks("10.0.0.0/8", "100.64.0.0/10", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+
+var (
+	callbackHostsLock sync.RWMutex
+	callbackHosts     []string
+)
+
+// SetCallbackAllowedHosts replaces the hosts callbacks may be sent to. Without any, callbacks may go to any host with a
+// public address. With some, only those hosts are allowed, but they may have private addresses
+func SetCallbackAllowedHosts(hosts []string) {
+	callbackHostsLock.Lock()
+	defer callbackHostsLock.Unlock()
+	callbackHosts = hosts
+}
+
+// CallbackAllowedHosts returns the hosts set with SetCallbackAllowedHosts
+func CallbackAllowedHosts() []string {
+	callbackHostsLock.RLock()
+	defer callbackHostsLock.RUnlock()
+	return callbackHosts
+}
+
+// CheckCallbackURL checks whether results may be sent to the host of a CallbackURL. Hostnames are checked again once
+// they are resolved, when the callback is sent
+func CheckCallbackURL(callbackURL string) error {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+
+	allowed := CallbackAllowedHosts()
+	if allowedHost(allowed, host) {
+		return nil
+	}
+	if len(allowed) > 0 {
+		return fmt.Errorf("the CallbackURL host %v is not one of the DT_CALLBACK_ALLOWED_HOSTS", host)
+	}
+
+	if ip := net.ParseIP(host); ip != nil && !publicAddress(ip) {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// dialCallback connects to the host of a callback, refusing private addresses unless the host is allowed explicitly
+func dialCallback(ctx context.Context, network string, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: callbackTimeout}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if !allowedHost(CallbackAllowedHosts(), host) {
+		dialer.Control = refusePrivateAddress
+	}
+
+	return dialer.DialContext(ctx, network, address)
+}
+
+// refusePrivateAddress stops a connection to a resolved address which isn't public
+func refusePrivateAddress(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !publicAddress(ip) {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// allowedHost checks whether a host is one of the allowed hosts
+func allowedHost(allowed []string, host string) bool {
+	for _, allowedHost := range allowed {
+		if strings.EqualFold(allowedHost, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicAddress checks whether an IP address is reachable from the internet, rather than only from inside the
+// network goDynaPerfSignature runs in
+func publicAddress(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+		return false
+	}
+
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseNetworks parses CIDR ranges which are known to be valid
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -0,0 +1,78 @@
+package evaluations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCallbackURL(t *testing.T) {
+	type testDefs struct {
+		Name          string
+		CallbackURL   string
+		AllowedHosts  []string
+		ExpectedError string
+	}
+
+	tests := []testDefs{
+		{
+			Name:        "Pass - public host",
+			CallbackURL: "https://ci.example.com/hooks/perfsig",
+		},
+		{
+			Name:        "Pass - public address",
+			CallbackURL: "https://203.0.113.10/hooks/perfsig",
+		},
+		{
+			Name:          "Fail - loopback address",
+			CallbackURL:   "http://127.0.0.1:8080/hook",
+			ExpectedError: errPrivateAddress.Error(),
+		},
+		{
+			Name:          "Fail - metadata endpoint",
+			CallbackURL:   "http://169.254.169.254/latest/meta-data/",
+			ExpectedError: errPrivateAddress.Error(),
+		},
+		{
+			Name:          "Fail - private address",
+			CallbackURL:   "http://10.1.2.3/hook",
+			ExpectedError: errPrivateAddress.Error(),
+		},
+		{
+			Name:          "Fail - private IPv6 address",
+			CallbackURL:   "http://[fd00::1]/hook",
+			ExpectedError: errPrivateAddress.Error(),
+		},
+		{
+			Name:         "Pass - allowed private host",
+			CallbackURL:  "http://10.1.2.3/hook",
+			AllowedHosts: []string{"ci.example.com", "10.1.2.3"},
+		},
+		{
+			Name:         "Pass - allowed host in another case",
+			CallbackURL:  "https://CI.example.com/hook",
+			AllowedHosts: []string{"ci.example.com"},
+		},
+		{
+			Name:          "Fail - host which isn't allowed",
+			CallbackURL:   "https://evil.example.com/hook",
+			AllowedHosts:  []string{"ci.example.com"},
+			ExpectedError: "the CallbackURL host evil.example.com is not one of the DT_CALLBACK_ALLOWED_HOSTS",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			SetCallbackAllowedHosts(test.AllowedHosts)
+			defer SetCallbackAllowedHosts(nil)
+
+			err := CheckCallbackURL(test.CallbackURL)
+
+			if test.ExpectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.ExpectedError)
+			}
+		})
+	}
+}
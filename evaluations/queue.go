@@ -0,0 +1,212 @@
+package evaluations
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/logging"
+)
+
+const (
+	// queueSize is how many jobs can wait for a worker before new submissions are refused
+	queueSize = 100
+
+	// maxReschedules is how many times a job whose window hasn't finished is run again before its pending result is
+	// returned as final
+	maxReschedules = 5
+
+	// jobRetention is how long a finished job can still be looked up
+	jobRetention = time.Hour
+)
+
+// ErrQueueFull is returned when too many jobs are already waiting for a worker
+var ErrQueueFull = errors.New("too many evaluations are waiting to run. Please try again later")
+
+// ProcessFunc evaluates a performance signature
+type ProcessFunc func(ctx context.Context, ps datatypes.PerformanceSignature) datatypes.PerformanceSignatureReturn
+
+// Queue runs evaluations in the background on a fixed number of workers
+type Queue struct {
+	ctx            context.Context
+	process        ProcessFunc
+	pending        chan *job
+	callbackClient *http.Client
+
+	lock sync.Mutex
+	jobs map[string]*job
+}
+
+// job is a submitted evaluation. Its status is guarded by the Queue's lock
+type job struct {
+	ps     datatypes.PerformanceSignature
+	status datatypes.EvaluationJob
+}
+
+// NewQueue starts the workers of a Queue. They stop, cancelling any running evaluations, when ctx is cancelled
+func NewQueue(ctx context.Context, workers int, process ProcessFunc) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+
+	q := &Queue{
+		ctx:            ctx,
+		process:        process,
+		pending:        make(chan *job, queueSize),
+		callbackClient: &http.Client{Timeout: callbackTimeout, Transport: &http.Transport{DialContext: dialCallback}},
+		jobs:           map[string]*job{},
+	}
+
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+
+	return q
+}
+
+// Submit queues a performance signature to be evaluated
+func (q *Queue) Submit(ps datatypes.PerformanceSignature) (datatypes.EvaluationJob, error) {
+	id, err := newJobID()
+	if err != nil {
+		return datatypes.EvaluationJob{}, err
+	}
+
+	j := &job{
+		ps: ps,
+		status: datatypes.EvaluationJob{
+			ID:          id,
+			Status:      datatypes.EvaluationStatusPending,
+			SubmittedAt: time.Now(),
+		},
+	}
+
+	q.lock.Lock()
+	q.prune(time.Now())
+	q.jobs[id] = j
+	status := j.status
+	q.lock.Unlock()
+
+	select {
+	case q.pending <- j:
+	default:
+		q.lock.Lock()
+		delete(q.jobs, id)
+		q.lock.Unlock()
+		return datatypes.EvaluationJob{}, ErrQueueFull
+	}
+
+	logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Queued evaluation %v", id)})
+	return status, nil
+}
+
+// Get returns the current state of a job
+func (q *Queue) Get(id string) (datatypes.EvaluationJob, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	j, ok := q.jobs[id]
+	if !ok {
+		return datatypes.EvaluationJob{}, false
+	}
+	return j.status, true
+}
+
+// work runs queued jobs until the Queue's context is cancelled
+func (q *Queue) work() {
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case j := <-q.pending:
+			q.run(j)
+		}
+	}
+}
+
+// run evaluates a job. A job whose window hasn't finished yet is queued again once it has
+func (q *Queue) run(j *job) {
+	q.lock.Lock()
+	started := time.Now()
+	j.status.Status = datatypes.EvaluationStatusRunning
+	j.status.Attempts++
+	j.status.StartedAt = &started
+	j.status.NextAttemptAt = nil
+	attempts := j.status.Attempts
+	q.lock.Unlock()
+
+	ctx := q.ctx
+	if attempts > maxReschedules {
+		ctx = WithFinalAttempt(ctx)
+	}
+	result := q.process(ctx, j.ps)
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if result.Pending && attempts <= maxReschedules && q.ctx.Err() == nil {
+		next := time.Now().Add(time.Duration(result.RetryAfterSecs) * time.Second)
+		j.status.Status = datatypes.EvaluationStatusPending
+		j.status.NextAttemptAt = &next
+		j.status.Result = &result
+
+		logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Evaluation %v is waiting for its window. Running it again at %v", j.status.ID, next)})
+		time.AfterFunc(time.Until(next), func() { q.requeue(j) })
+		return
+	}
+
+	finished := time.Now()
+	j.status.Status = datatypes.EvaluationStatusDone
+	j.status.FinishedAt = &finished
+	j.status.Result = &result
+	logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Finished evaluation %v", j.status.ID)})
+
+	if j.ps.CallbackURL != "" {
+		j.status.Callback = &datatypes.CallbackDelivery{URL: j.ps.CallbackURL, Status: datatypes.CallbackStatusPending}
+		go q.deliverCallback(j, result)
+	}
+}
+
+type finalAttemptKey struct{}
+
+// WithFinalAttempt returns a context for the last run of a job, whose result is final even if it is still pending
+func WithFinalAttempt(ctx context.Context) context.Context {
+	return context.WithValue(ctx, finalAttemptKey{}, true)
+}
+
+// FinalAttempt checks whether a job running with ctx won't be rescheduled again
+func FinalAttempt(ctx context.Context) bool {
+	final, _ := ctx.Value(finalAttemptKey{}).(bool)
+	return final
+}
+
+// requeue puts a rescheduled job back in line, waiting for room if the queue is full
+func (q *Queue) requeue(j *job) {
+	select {
+	case q.pending <- j:
+	case <-q.ctx.Done():
+	}
+}
+
+// prune forgets the jobs which finished more than jobRetention ago. The caller must hold the lock
+func (q *Queue) prune(now time.Time) {
+	for id, j := range q.jobs {
+		if j.status.FinishedAt != nil && now.Sub(*j.status.FinishedAt) > jobRetention {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// newJobID creates a random ID for a job
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not create a job ID: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,145 @@
+package evaluations
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/stretchr/testify/assert"
+)
+
+// waitForStatus polls a job until it reaches the status, failing the test if it takes too long
+func waitForStatus(t *testing.T, q *Queue, id string, status string) datatypes.EvaluationJob {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := q.Get(id)
+		if ok && job.Status == status {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %v never became %v", id, status)
+	return datatypes.EvaluationJob{}
+}
+
+func TestQueueRunsJobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewQueue(ctx, 2, func(ctx context.Context, ps datatypes.PerformanceSignature) datatypes.PerformanceSignatureReturn {
+		return datatypes.PerformanceSignatureReturn{Pass: true, Response: []string{ps.ServiceID}}
+	})
+
+	ps := datatypes.GetValidStaticPerformanceSignature()
+	job, err := q.Submit(ps)
+	assert.NoError(t, err)
+	assert.Equal(t, datatypes.EvaluationStatusPending, job.Status)
+	assert.Len(t, job.ID, 32)
+
+	done := waitForStatus(t, q, job.ID, datatypes.EvaluationStatusDone)
+	assert.Equal(t, 1, done.Attempts)
+	assert.NotNil(t, done.StartedAt)
+	assert.NotNil(t, done.FinishedAt)
+	assert.True(t, done.Result.Pass)
+	assert.Equal(t, []string{ps.ServiceID}, done.Result.Response)
+}
+
+func TestQueueReschedulesPendingJobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int32
+	q := NewQueue(ctx, 1, func(ctx context.Context, ps datatypes.PerformanceSignature) datatypes.PerformanceSignatureReturn {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return datatypes.PerformanceSignatureReturn{Pending: true, RetryAfterSecs: 0}
+		}
+		return datatypes.PerformanceSignatureReturn{Pass: true}
+	})
+
+	job, err := q.Submit(datatypes.GetValidStaticPerformanceSignature())
+	assert.NoError(t, err)
+
+	done := waitForStatus(t, q, job.ID, datatypes.EvaluationStatusDone)
+	assert.Equal(t, 2, done.Attempts)
+	assert.Nil(t, done.NextAttemptAt)
+	assert.True(t, done.Result.Pass)
+}
+
+func TestQueueGivesUpRescheduling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var finalAttempts int32
+	q := NewQueue(ctx, 1, func(ctx context.Context, ps datatypes.PerformanceSignature) datatypes.PerformanceSignatureReturn {
+		if FinalAttempt(ctx) {
+			atomic.AddInt32(&finalAttempts, 1)
+		}
+		return datatypes.PerformanceSignatureReturn{Pending: true, RetryAfterSecs: 0}
+	})
+
+	job, err := q.Submit(datatypes.GetValidStaticPerformanceSignature())
+	assert.NoError(t, err)
+
+	done := waitForStatus(t, q, job.ID, datatypes.EvaluationStatusDone)
+	assert.Equal(t, maxReschedules+1, done.Attempts)
+	assert.True(t, done.Result.Pending)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&finalAttempts))
+}
+
+func TestQueueFull(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Block the only worker so nothing leaves the queue
+	release := make(chan struct{})
+	defer close(release)
+	q := NewQueue(ctx, 1, func(ctx context.Context, ps datatypes.PerformanceSignature) datatypes.PerformanceSignatureReturn {
+		<-release
+		return datatypes.PerformanceSignatureReturn{Pass: true}
+	})
+
+	first, err := q.Submit(datatypes.GetValidStaticPerformanceSignature())
+	assert.NoError(t, err)
+	waitForStatus(t, q, first.ID, datatypes.EvaluationStatusRunning)
+
+	for i := 0; i < queueSize; i++ {
+		_, err := q.Submit(datatypes.GetValidStaticPerformanceSignature())
+		assert.NoError(t, err)
+	}
+
+	_, err = q.Submit(datatypes.GetValidStaticPerformanceSignature())
+	assert.Equal(t, ErrQueueFull, err)
+}
+
+func TestQueueGetUnknownJob(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewQueue(ctx, 1, nil)
+
+	_, ok := q.Get("missing")
+	assert.False(t, ok)
+}
+
+func TestQueuePrune(t *testing.T) {
+	now := time.Now()
+	longAgo := now.Add(-2 * jobRetention)
+	recently := now.Add(-time.Minute)
+
+	q := &Queue{jobs: map[string]*job{
+		"old":     {status: datatypes.EvaluationJob{ID: "old", FinishedAt: &longAgo}},
+		"recent":  {status: datatypes.EvaluationJob{ID: "recent", FinishedAt: &recently}},
+		"waiting": {status: datatypes.EvaluationJob{ID: "waiting", SubmittedAt: longAgo}},
+	}}
+
+	q.prune(now)
+
+	_, ok := q.Get("old")
+	assert.False(t, ok)
+	_, ok = q.Get("recent")
+	assert.True(t, ok)
+	_, ok = q.Get("waiting")
+	assert.True(t, ok)
+}
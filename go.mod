@@ -7,5 +7,6 @@ require (
 	github.com/gorilla/mux v1.7.3
 	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.4.0
+	go.etcd.io/bbolt v1.3.6
 	gopkg.in/yaml.v2 v2.2.7
 )
@@ -0,0 +1,224 @@
+package history
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/evaluations"
+	"github.com/barrebre/goDynaPerfSignature/logging"
+	"github.com/barrebre/goDynaPerfSignature/performancesignature"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// DefaultListLimit is how many evaluations are listed unless asked otherwise
+	DefaultListLimit = 50
+
+	// MaxListLimit bounds how many evaluations can be listed at once
+	MaxListLimit = 500
+
+	// openTimeout is how long to wait for another process to release the history file
+	openTimeout = 5 * time.Second
+)
+
+var (
+	// evaluationsBucket maps the ID of every evaluation to its EvaluationRecord
+	evaluationsBucket = []byte("evaluations")
+
+	// servicesBucket holds a bucket for each service, listing the IDs of the evaluations which included it
+	servicesBucket = []byte("services")
+)
+
+// ProcessFunc evaluates a performance signature
+type ProcessFunc func(ctx context.Context, ps datatypes.PerformanceSignature) datatypes.PerformanceSignatureReturn
+
+// Store keeps finished evaluations in a file, so they can be audited later
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens the history file at path, creating it if it doesn't exist yet
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("could not open the history file %v: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{evaluationsBucket, servicesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not prepare the history file %v: %w", path, err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close releases the history file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Record wraps process so every evaluation it finishes is saved. Pending evaluations haven't evaluated anything
+// yet, so only their final attempt is kept
+func (s *Store) Record(process ProcessFunc) ProcessFunc {
+	return func(ctx context.Context, ps datatypes.PerformanceSignature) datatypes.PerformanceSignatureReturn {
+		started := time.Now()
+		ctx, details := performancesignature.WithEvaluationDetails(ctx)
+
+		// A pending result is only kept once the queue has given up running it again
+		result := process(ctx, ps)
+		if result.Pending && !evaluations.FinalAttempt(ctx) {
+			return result
+		}
+
+		id, err := s.Save(datatypes.EvaluationRecord{
+			Request:    ps,
+			Services:   details.Services(),
+			Result:     result,
+			StartedAt:  started,
+			FinishedAt: time.Now(),
+		})
+		if err != nil {
+			logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Could not save the evaluation to the history: %v", err)})
+			return result
+		}
+
+		result.HistoryID = id
+		return result
+	}
+}
+
+// Save stores an evaluation, returning its ID. Records without an ID are given one which sorts after every
+// earlier evaluation. Credentials are never stored
+func (s *Store) Save(record datatypes.EvaluationRecord) (string, error) {
+	if record.ID == "" {
+		id, err := newRecordID(record.StartedAt)
+		if err != nil {
+			return "", err
+		}
+		record.ID = id
+	}
+	record.Request.APIToken = ""
+	record.Request.CallbackSecret = ""
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal the evaluation: %w", err)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(evaluationsBucket).Put([]byte(record.ID), value); err != nil {
+			return err
+		}
+
+		for _, serviceID := range performancesignature.GetServiceIDs(record.Request) {
+			services, err := tx.Bucket(servicesBucket).CreateBucketIfNotExists([]byte(serviceID))
+			if err != nil {
+				return err
+			}
+			if err := services.Put([]byte(record.ID), []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not save the evaluation: %w", err)
+	}
+
+	return record.ID, nil
+}
+
+// Get returns a single evaluation. The bool is false if there is no evaluation with the ID
+func (s *Store) Get(id string) (datatypes.EvaluationRecord, bool, error) {
+	var record datatypes.EvaluationRecord
+	found := false
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(evaluationsBucket).Get([]byte(id))
+		if value == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(value, &record)
+	})
+	if err != nil {
+		return datatypes.EvaluationRecord{}, false, fmt.Errorf("could not read evaluation %v: %w", id, err)
+	}
+
+	return record, found, nil
+}
+
+// List returns up to limit evaluations, newest first. If serviceID is set, only evaluations which included that
+// service are listed
+func (s *Store) List(serviceID string, limit int) ([]datatypes.EvaluationSummary, error) {
+	if limit < 1 || limit > MaxListLimit {
+		limit = DefaultListLimit
+	}
+
+	summaries := []datatypes.EvaluationSummary{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		evaluations := tx.Bucket(evaluationsBucket)
+
+		// Both buckets are keyed by the evaluation IDs, which sort by when the evaluations started
+		index := evaluations
+		if serviceID != "" {
+			index = tx.Bucket(servicesBucket).Bucket([]byte(serviceID))
+			if index == nil {
+				return nil
+			}
+		}
+
+		cursor := index.Cursor()
+		for id, _ := cursor.Last(); id != nil && len(summaries) < limit; id, _ = cursor.Prev() {
+			var record datatypes.EvaluationRecord
+			if err := json.Unmarshal(evaluations.Get(id), &record); err != nil {
+				return fmt.Errorf("could not read evaluation %s: %w", id, err)
+			}
+			summaries = append(summaries, summarize(record))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return summaries, nil
+}
+
+// summarize shortens a record for listing
+func summarize(record datatypes.EvaluationRecord) datatypes.EvaluationSummary {
+	return datatypes.EvaluationSummary{
+		ID:               record.ID,
+		ServiceIDs:       performancesignature.GetServiceIDs(record.Request),
+		Signature:        record.Request.Signature,
+		SignatureVersion: record.Request.SignatureVersion,
+		Pass:             record.Result.Pass,
+		Error:            record.Result.Error,
+		ErrorCode:        record.Result.ErrorCode,
+		StartedAt:        record.StartedAt,
+		FinishedAt:       record.FinishedAt,
+	}
+}
+
+// newRecordID creates an ID which starts with the time, so IDs sort in the order the evaluations started
+func newRecordID(started time.Time) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not create an evaluation ID: %v", err)
+	}
+	return fmt.Sprintf("%016x%v", started.UnixNano(), hex.EncodeToString(b)), nil
+}
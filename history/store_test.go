@@ -0,0 +1,224 @@
+package history
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/evaluations"
+	"github.com/stretchr/testify/assert"
+)
+
+// openTestStore opens a store in a temporary directory, returning a func which removes it again
+func openTestStore(t *testing.T) (*Store, string, func()) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "history.db")
+	store, err := Open(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return store, path, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSaveAndGet(t *testing.T) {
+	store, _, cleanup := openTestStore(t)
+	defer cleanup()
+
+	record := datatypes.GetEvaluationRecord()
+	record.Request.APIToken = "S2pMHW_FSlma-PPJIj3l5"
+	record.Request.CallbackSecret = "s3cret"
+
+	id, err := store.Save(record)
+	assert.NoError(t, err)
+	assert.Equal(t, record.ID, id)
+
+	saved, ok, err := store.Get(id)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, saved.Request.APIToken)
+	assert.Empty(t, saved.Request.CallbackSecret)
+
+	expected := datatypes.GetEvaluationRecord()
+	assert.Equal(t, expected.Services, saved.Services)
+	assert.Equal(t, expected.Result, saved.Result)
+	assert.Equal(t, expected.Request.PSMetrics, saved.Request.PSMetrics)
+	assert.True(t, expected.StartedAt.Equal(saved.StartedAt))
+
+	_, ok, err = store.Get("missing")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestSaveAssignsSortableIDs(t *testing.T) {
+	store, _, cleanup := openTestStore(t)
+	defer cleanup()
+
+	start := time.Now()
+	record := datatypes.GetEvaluationRecord()
+	record.ID = ""
+
+	record.StartedAt = start
+	first, err := store.Save(record)
+	assert.NoError(t, err)
+
+	record.StartedAt = start.Add(time.Second)
+	second, err := store.Save(record)
+	assert.NoError(t, err)
+
+	assert.Len(t, first, 32)
+	assert.True(t, first < second)
+}
+
+func TestList(t *testing.T) {
+	type testDefs struct {
+		Name        string
+		ServiceID   string
+		Limit       int
+		ExpectedIDs []string
+	}
+
+	store, _, cleanup := openTestStore(t)
+	defer cleanup()
+
+	records := []struct {
+		ID       string
+		Services []string
+		Pass     bool
+	}{
+		{ID: "01", Services: []string{"SERVICE-A"}, Pass: true},
+		{ID: "02", Services: []string{"SERVICE-B"}, Pass: false},
+		{ID: "03", Services: []string{"SERVICE-A", "SERVICE-B"}, Pass: true},
+	}
+	for _, r := range records {
+		record := datatypes.GetEvaluationRecord()
+		record.ID = r.ID
+		record.Request.ServiceID = ""
+		record.Request.ServiceIDs = r.Services
+		record.Result.Pass = r.Pass
+		_, err := store.Save(record)
+		assert.NoError(t, err)
+	}
+
+	tests := []testDefs{
+		{
+			Name:        "Every evaluation, newest first",
+			ExpectedIDs: []string{"03", "02", "01"},
+		},
+		{
+			Name:        "A single service",
+			ServiceID:   "SERVICE-A",
+			ExpectedIDs: []string{"03", "01"},
+		},
+		{
+			Name:        "Limited",
+			ServiceID:   "SERVICE-B",
+			Limit:       1,
+			ExpectedIDs: []string{"03"},
+		},
+		{
+			Name:        "Unknown service",
+			ServiceID:   "SERVICE-C",
+			ExpectedIDs: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			summaries, err := store.List(test.ServiceID, test.Limit)
+			assert.NoError(t, err)
+
+			ids := []string{}
+			for _, summary := range summaries {
+				ids = append(ids, summary.ID)
+			}
+			assert.Equal(t, test.ExpectedIDs, ids)
+		})
+	}
+
+	summaries, _ := store.List("SERVICE-B", 0)
+	assert.Equal(t, []string{"SERVICE-A", "SERVICE-B"}, summaries[0].ServiceIDs)
+	assert.True(t, summaries[0].Pass)
+	assert.False(t, summaries[1].Pass)
+}
+
+func TestRecord(t *testing.T) {
+	store, _, cleanup := openTestStore(t)
+	defer cleanup()
+
+	results := []datatypes.PerformanceSignatureReturn{
+		{Pending: true, RetryAfterSecs: 30},
+		{Pass: false, Response: []string{"Too slow"}},
+		{Pending: true, RetryAfterSecs: 30},
+	}
+	calls := 0
+	evaluate := store.Record(func(ctx context.Context, ps datatypes.PerformanceSignature) datatypes.PerformanceSignatureReturn {
+		calls++
+		return results[calls-1]
+	})
+
+	ps := datatypes.GetValidStaticPerformanceSignature()
+
+	// Pending evaluations aren't kept
+	pending := evaluate(context.Background(), ps)
+	assert.Empty(t, pending.HistoryID)
+	summaries, _ := store.List("", 0)
+	assert.Empty(t, summaries)
+
+	failed := evaluate(context.Background(), ps)
+	assert.NotEmpty(t, failed.HistoryID)
+
+	record, ok, err := store.Get(failed.HistoryID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"Too slow"}, record.Result.Response)
+	assert.Equal(t, ps.ServiceID, record.Request.ServiceID)
+	assert.Empty(t, record.Request.APIToken)
+	assert.False(t, record.FinishedAt.Before(record.StartedAt))
+
+	// Unless the queue won't run them again
+	final := evaluate(evaluations.WithFinalAttempt(context.Background()), ps)
+	assert.True(t, final.Pending)
+	assert.NotEmpty(t, final.HistoryID)
+}
+
+func TestReopen(t *testing.T) {
+	store, path, cleanup := openTestStore(t)
+	defer cleanup()
+
+	id, err := store.Save(datatypes.GetEvaluationRecord())
+	assert.NoError(t, err)
+	store.Close()
+
+	reopened, err := Open(path)
+	assert.NoError(t, err)
+	defer reopened.Close()
+
+	_, ok, err := reopened.Get(id)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestSummarizeSignatureVersion(t *testing.T) {
+	record := datatypes.GetEvaluationRecord()
+	record.Request.Signature = "checkout-api"
+	record.Request.SignatureVersion = 3
+
+	summary := summarize(record)
+
+	assert.Equal(t, "checkout-api", summary.Signature)
+	assert.Equal(t, 3, summary.SignatureVersion)
+	assert.Equal(t, []string{"SERVICE-5D4E743B2BF0CCF5"}, summary.ServiceIDs)
+}
@@ -6,14 +6,21 @@ import (
 	"log"
 	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/barrebre/goDynaPerfSignature/datatypes"
 )
 
-var logLevel = "ERROR"
+var (
+	logLevel     = "ERROR"
+	logLevelLock sync.RWMutex
+)
 
-// SetLogLevel allows the app to set the appropriate log level based on config
+// SetLogLevel allows the app to set the appropriate log level based on config. It can be called while requests are
+// logging, such as when the config is reloaded
 func SetLogLevel(level string) {
+	logLevelLock.Lock()
+	defer logLevelLock.Unlock()
 	logLevel = level
 }
 
@@ -45,6 +52,8 @@ func LogInfo(info datatypes.Logging) {
 
 // getLoggingLevel returns the logging level the app is set to
 func getLoggingLevel() string {
+	logLevelLock.RLock()
+	defer logLevelLock.RUnlock()
 	return logLevel
 }
 
@@ -58,10 +67,10 @@ func writeLog(info datatypes.Logging, level string) {
 	// Add message
 	logMsg += fmt.Sprintf(`"message":"%v",`, info.Message)
 
-	// Possibly add perfSig
+	// Possibly add perfSig. Its credentials are Secrets, so they are masked
 	if len(info.PerfSig.PSMetrics) > 0 {
 		sig, _ := json.Marshal(info.PerfSig)
-		logMsg += string(sig)
+		logMsg += fmt.Sprintf(`"perfSig":%v,`, string(sig))
 	}
 
 	// Add source logging method
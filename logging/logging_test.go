@@ -1,6 +1,11 @@
 package logging
 
 import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/barrebre/goDynaPerfSignature/datatypes"
@@ -37,6 +42,24 @@ func TestSetLogLevel(t *testing.T) {
 	}
 }
 
+func TestSetLogLevelWhileLogging(t *testing.T) {
+	defer SetLogLevel("ERROR")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			SetLogLevel("ERROR")
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		LogDebug(datatypes.Logging{Message: "racing a reload"})
+	}
+	<-done
+	assert.Equal(t, "ERROR", getLoggingLevel())
+}
+
 func TestNoReturnMethods(t *testing.T) {
 	perfSig := datatypes.PerformanceSignature{
 		PSMetrics: map[string]datatypes.PSMetric{
@@ -49,6 +72,31 @@ func TestNoReturnMethods(t *testing.T) {
 	LogSystem(datatypes.Logging{Message: "asdf"})
 }
 
+func TestWriteLogMasksSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer log.SetOutput(os.Stderr)
+	defer log.SetFlags(log.LstdFlags)
+
+	perfSig := datatypes.PerformanceSignature{
+		APIToken:       "dt0c01.secret",
+		CallbackSecret: "s3cret",
+		PSMetrics: map[string]datatypes.PSMetric{
+			"asdf": {},
+		},
+	}
+	LogSystem(datatypes.Logging{Message: "asdf", PerfSig: perfSig})
+
+	line := strings.TrimSpace(buf.String())
+	assert.NotContains(t, line, "dt0c01.secret")
+	assert.NotContains(t, line, "s3cret")
+
+	var written map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(line), &written))
+	assert.Equal(t, "****", written["perfSig"].(map[string]interface{})["APIToken"])
+}
+
 func TestShortenedFileName(t *testing.T) {
 	type testDefs struct {
 		Name           string
@@ -2,16 +2,28 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/dynatrace"
+	"github.com/barrebre/goDynaPerfSignature/evaluations"
+	"github.com/barrebre/goDynaPerfSignature/history"
 	"github.com/barrebre/goDynaPerfSignature/logging"
 	"github.com/barrebre/goDynaPerfSignature/performancesignature"
+	"github.com/barrebre/goDynaPerfSignature/reload"
+	"github.com/barrebre/goDynaPerfSignature/signatures"
+	"github.com/barrebre/goDynaPerfSignature/tokens"
 	"github.com/barrebre/goDynaPerfSignature/utils"
 
 	"github.com/gorilla/mux"
@@ -21,13 +33,83 @@ const badRequestMessage = "Please ensure your request meets the required specifi
 
 // Create the paths to access the APIs
 func main() {
-	logging.LogSystem(datatypes.Logging{Message: fmt.Sprintf("Starting goDynaPerfSig version: %v on port 8080", utils.GetAppVersion())})
+	configFile := flag.String("config", os.Getenv("DT_CONFIG_FILE"), "path to a YAML config file")
+	flag.Parse()
 
 	// Get config
-	config := utils.GetConfig()
+	config, err := utils.GetConfig(*configFile)
+	if err != nil {
+		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Could not load the config: %v", err)})
+		os.Exit(1)
+	}
+	logging.SetLogLevel(config.LogLevel)
+
+	logging.LogSystem(datatypes.Logging{Message: fmt.Sprintf("Starting goDynaPerfSig version: %v on port %v", utils.GetAppVersion(), config.Port)})
+	utils.LogConfigSummary(config)
+
+	// Set up the shared Dynatrace client
+	client, err := dynatrace.NewClient(config)
+	if err != nil {
+		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Could not configure the Dynatrace client: %v", err)})
+		os.Exit(1)
+	}
+	dynatrace.SetDefaultClient(client)
+
+	// Read API tokens from their files. A file which changes is read again on the next request which needs it
+	tokenFiles := tokens.NewFileProvider(tokens.FilesFromConfig(config))
+	if err := tokenFiles.Check(); err != nil {
+		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Could not read the API tokens: %v", err)})
+		os.Exit(1)
+	}
+	tokens.SetDefaultProvider(tokenFiles)
+
+	// Only send callbacks where they are allowed to go
+	evaluations.SetCallbackAllowedHosts(config.CallbackAllowedHosts)
+
+	// Load the signatures requests can reference by name
+	if config.SignaturesDir != "" {
+		registry, err := signatures.LoadDir(config.SignaturesDir)
+		if err != nil {
+			logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Could not load the signatures: %v", err)})
+			os.Exit(1)
+		}
+		signatures.SetDefaultRegistry(registry)
+		logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Loaded the signatures %v", strings.Join(registry.Names(), ", "))})
+	}
+
+	// Every request context derives from this one, so shutting down cancels in-flight Dynatrace queries
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+
+	// Keep every evaluation in the history, if it has a file which can be opened
+	evaluate := performancesignature.ProcessRequest
+	var store *history.Store
+	if config.HistoryFile != "" {
+		store, err = history.Open(config.HistoryFile)
+		if err != nil {
+			logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Evaluations won't be kept in the history: %v", err)})
+		} else {
+			evaluate = store.Record(evaluate)
+		}
+	}
+
+	// Set up the workers for asynchronous evaluations
+	queue := evaluations.NewQueue(baseCtx, config.EvaluationWorkers, evaluate)
+
+	// Pick up changes to the config file and the signatures directory, whether they are noticed or signalled
+	reloader := reload.New(config, tokenFiles)
+	go reloader.Watch(baseCtx, time.Second*time.Duration(config.ReloadIntervalSecs))
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			logging.LogSystem(datatypes.Logging{Message: "Received SIGHUP. Reloading the config and signatures."})
+			reloader.Reload()
+		}
+	}()
 
 	// Set up server
-	var wait time.Duration
+	wait := time.Second * time.Duration(config.ShutdownTimeoutSecs)
 	r := mux.NewRouter()
 
 	r.HandleFunc("/performanceSignature", func(w http.ResponseWriter, r *http.Request) {
@@ -37,38 +119,316 @@ func main() {
 			errMessage := fmt.Sprintf("Couldn't parse the body of the request. Error was: %v.", err.Error())
 			logging.LogError(datatypes.Logging{Message: errMessage})
 			response := datatypes.PerformanceSignatureReturn{
-				Error:    true,
-				Response: []string{errMessage, badRequestMessage},
+				Error:     true,
+				ErrorCode: datatypes.ErrorCodeInvalidRequest,
+				Response:  []string{errMessage, badRequestMessage},
 			}
 			utils.WriteResponse(w, response, datatypes.PerformanceSignature{})
 			return
 		}
 
 		// Pull out and verify the provided params
-		ps, err := performancesignature.ReadAndValidateParams(b, config)
+		ps, err := performancesignature.ReadAndValidateParams(r.Context(), b, reloader.Config())
 		if err != nil {
 			errMessage := fmt.Sprintf("Could not ReadAndValidateParams. Error was: %v.", err.Error())
 			logging.LogError(datatypes.Logging{Message: errMessage})
 			response := datatypes.PerformanceSignatureReturn{
-				Error:    true,
-				Response: []string{errMessage, badRequestMessage},
+				Error:     true,
+				ErrorCode: performancesignature.ValidationErrorCode(err),
+				Response:  []string{errMessage, badRequestMessage},
+			}
+			utils.WriteResponse(w, response, datatypes.PerformanceSignature{})
+			return
+		}
+
+		err = performancesignature.CheckSynchronous(ps)
+		if err != nil {
+			errMessage := fmt.Sprintf("CallbackURL is only supported on /evaluations. Error was: %v.", err.Error())
+			logging.LogError(datatypes.Logging{Message: errMessage})
+			response := datatypes.PerformanceSignatureReturn{
+				Error:     true,
+				ErrorCode: datatypes.ErrorCodeInvalidRequest,
+				Response:  []string{errMessage, badRequestMessage},
 			}
 			utils.WriteResponse(w, response, datatypes.PerformanceSignature{})
 			return
 		}
 
-		// Perform the performance signature
-		response := performancesignature.ProcessRequest(w, r, ps)
+		// Perform the performance signature, only waiting for its window if the response can still be written afterwards
+		ctx := performancesignature.WithWaitLimit(r.Context(), time.Second*time.Duration(config.WriteTimeoutSecs)/2)
+		response := evaluate(ctx, ps)
 
 		utils.WriteResponse(w, response, ps)
 	})
 
+	r.HandleFunc("/deployment", func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			errMessage := fmt.Sprintf("Couldn't parse the body of the request. Error was: %v.", err.Error())
+			logging.LogError(datatypes.Logging{Message: errMessage})
+			utils.WriteDeploymentResponse(w, datatypes.DeploymentReturn{
+				Error:     true,
+				ErrorCode: datatypes.ErrorCodeInvalidRequest,
+				Response:  []string{errMessage, badRequestMessage},
+			})
+			return
+		}
+
+		// Pull out and verify the provided params
+		dr, err := performancesignature.ReadAndValidateDeploymentParams(b, reloader.Config())
+		if err != nil {
+			errMessage := fmt.Sprintf("Could not ReadAndValidateDeploymentParams. Error was: %v.", err.Error())
+			logging.LogError(datatypes.Logging{Message: errMessage})
+			utils.WriteDeploymentResponse(w, datatypes.DeploymentReturn{
+				Error:     true,
+				ErrorCode: datatypes.ErrorCodeInvalidRequest,
+				Response:  []string{errMessage, badRequestMessage},
+			})
+			return
+		}
+
+		// Push the deployment event to Dynatrace
+		response := performancesignature.PushDeployment(r.Context(), dr)
+
+		utils.WriteDeploymentResponse(w, response)
+	}).Methods("POST")
+
+	r.HandleFunc("/evaluations", func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			errMessage := fmt.Sprintf("Couldn't parse the body of the request. Error was: %v.", err.Error())
+			logging.LogError(datatypes.Logging{Message: errMessage})
+			response := datatypes.PerformanceSignatureReturn{
+				Error:     true,
+				ErrorCode: datatypes.ErrorCodeInvalidRequest,
+				Response:  []string{errMessage, badRequestMessage},
+			}
+			utils.WriteResponse(w, response, datatypes.PerformanceSignature{})
+			return
+		}
+
+		// Pull out and verify the provided params, so a bad request is refused right away
+		ps, err := performancesignature.ReadAndValidateParams(r.Context(), b, reloader.Config())
+		if err != nil {
+			errMessage := fmt.Sprintf("Could not ReadAndValidateParams. Error was: %v.", err.Error())
+			logging.LogError(datatypes.Logging{Message: errMessage})
+			response := datatypes.PerformanceSignatureReturn{
+				Error:     true,
+				ErrorCode: performancesignature.ValidationErrorCode(err),
+				Response:  []string{errMessage, badRequestMessage},
+			}
+			utils.WriteResponse(w, response, datatypes.PerformanceSignature{})
+			return
+		}
+
+		job, err := queue.Submit(ps)
+		if err != nil {
+			logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Could not queue the evaluation: %v", err)})
+			response := datatypes.PerformanceSignatureReturn{
+				Error:     true,
+				ErrorCode: datatypes.ErrorCodeQueueFull,
+				Response:  []string{fmt.Sprintf("Could not queue the evaluation: %v", err)},
+			}
+			utils.WriteResponse(w, response, ps)
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/evaluations/%v", job.ID))
+		utils.WriteJSON(w, http.StatusAccepted, job, "evaluation job")
+	}).Methods("POST")
+
+	r.HandleFunc("/evaluations/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		job, ok := queue.Get(id)
+		if !ok {
+			response := datatypes.PerformanceSignatureReturn{
+				Error:     true,
+				ErrorCode: datatypes.ErrorCodeNotFound,
+				Response:  []string{fmt.Sprintf("There is no evaluation with the ID %v. Finished evaluations are kept for an hour", id)},
+			}
+			utils.WriteResponse(w, response, datatypes.PerformanceSignature{})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, job, "evaluation job")
+	}).Methods("GET")
+
+	r.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			writeHistoryUnavailable(w)
+			return
+		}
+
+		limit := history.DefaultListLimit
+		if l := r.URL.Query().Get("limit"); l != "" {
+			parsed, err := strconv.Atoi(l)
+			if err != nil || parsed < 1 || parsed > history.MaxListLimit {
+				response := datatypes.PerformanceSignatureReturn{
+					Error:     true,
+					ErrorCode: datatypes.ErrorCodeInvalidRequest,
+					Response:  []string{fmt.Sprintf("The limit must be a number from 1 to %v", history.MaxListLimit)},
+				}
+				utils.WriteResponse(w, response, datatypes.PerformanceSignature{})
+				return
+			}
+			limit = parsed
+		}
+
+		summaries, err := store.List(r.URL.Query().Get("serviceId"), limit)
+		if err != nil {
+			logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Could not list the history: %v", err)})
+			response := datatypes.PerformanceSignatureReturn{
+				Error:     true,
+				ErrorCode: datatypes.ErrorCodeInternal,
+				Response:  []string{fmt.Sprintf("Could not list the history: %v", err)},
+			}
+			utils.WriteResponse(w, response, datatypes.PerformanceSignature{})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, summaries, "history")
+	}).Methods("GET")
+
+	r.HandleFunc("/history/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			writeHistoryUnavailable(w)
+			return
+		}
+
+		id := mux.Vars(r)["id"]
+		record, ok, err := store.Get(id)
+		if err != nil || !ok {
+			response := datatypes.PerformanceSignatureReturn{
+				Error:     true,
+				ErrorCode: datatypes.ErrorCodeNotFound,
+				Response:  []string{fmt.Sprintf("There is no evaluation with the ID %v in the history", id)},
+			}
+			if err != nil {
+				logging.LogError(datatypes.Logging{Message: err.Error()})
+				response.ErrorCode = datatypes.ErrorCodeInternal
+				response.Response = []string{err.Error()}
+			}
+			utils.WriteResponse(w, response, datatypes.PerformanceSignature{})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, record, "history record")
+	}).Methods("GET")
+
+	r.HandleFunc("/signatures", func(w http.ResponseWriter, r *http.Request) {
+		utils.WriteJSON(w, http.StatusOK, signatures.DefaultRegistry().List(), "signatures")
+	}).Methods("GET")
+
+	r.HandleFunc("/signatures/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+
+		version := 0
+		if v := r.URL.Query().Get("version"); v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil || parsed < 1 {
+				writeSignatureError(w, datatypes.ErrorCodeInvalidRequest, fmt.Sprintf("The version must be a positive number, but was %v", v))
+				return
+			}
+			version = parsed
+		}
+
+		signature, ok := signatures.DefaultRegistry().Get(name)
+		if version != 0 {
+			signature, ok = signatures.DefaultRegistry().GetVersion(name, version)
+		}
+		if !ok {
+			writeSignatureError(w, datatypes.ErrorCodeNotFound, fmt.Sprintf("There is no signature named %v", name))
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, signature, "signature")
+	}).Methods("GET")
+
+	r.HandleFunc("/signatures/{name}/versions", func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+
+		versions := signatures.DefaultRegistry().Versions(name)
+		if len(versions) == 0 {
+			writeSignatureError(w, datatypes.ErrorCodeNotFound, fmt.Sprintf("There is no signature named %v", name))
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, versions, "signature versions")
+	}).Methods("GET")
+
+	r.HandleFunc("/signatures/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+
+		b, err := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			writeSignatureError(w, datatypes.ErrorCodeInvalidRequest, fmt.Sprintf("Couldn't parse the body of the request. Error was: %v.", err.Error()))
+			return
+		}
+
+		// Validate the definition with the same rules as the PSMetrics of a request
+		signature, err := signatures.Parse(b, name)
+		if err != nil {
+			writeSignatureError(w, datatypes.ErrorCodeInvalidRequest, fmt.Sprintf("Invalid signature: %v", err))
+			return
+		}
+		if signature.Name != name {
+			writeSignatureError(w, datatypes.ErrorCodeInvalidRequest, fmt.Sprintf("The Name %v doesn't match the signature %v in the URL", signature.Name, name))
+			return
+		}
+
+		stored, err := signatures.DefaultRegistry().Put(signature)
+		if errors.Is(err, signatures.ErrNoDir) {
+			writeSignatureError(w, datatypes.ErrorCodeInvalidRequest, fmt.Sprintf("Could not store the signature: %v", err))
+			return
+		}
+		if err != nil {
+			logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Could not store the signature %v: %v", name, err)})
+			writeSignatureError(w, datatypes.ErrorCodeInternal, fmt.Sprintf("Could not store the signature: %v", err))
+			return
+		}
+
+		logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Stored version %v of the signature %v", stored.Version, name)})
+		utils.WriteJSON(w, http.StatusOK, stored, "signature")
+	}).Methods("PUT")
+
+	r.HandleFunc("/signatures/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+
+		err := signatures.DefaultRegistry().Delete(name)
+		if errors.Is(err, signatures.ErrNotFound) {
+			writeSignatureError(w, datatypes.ErrorCodeNotFound, fmt.Sprintf("There is no signature named %v", name))
+			return
+		}
+		if errors.Is(err, signatures.ErrNoDir) {
+			writeSignatureError(w, datatypes.ErrorCodeInvalidRequest, fmt.Sprintf("Could not delete the signature: %v", err))
+			return
+		}
+		if err != nil {
+			logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Could not delete the signature %v: %v", name, err)})
+			writeSignatureError(w, datatypes.ErrorCodeInternal, fmt.Sprintf("Could not delete the signature: %v", err))
+			return
+		}
+
+		logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Deleted the signature %v", name)})
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+
+	r.HandleFunc("/cacheStats", func(w http.ResponseWriter, r *http.Request) {
+		utils.WriteJSON(w, http.StatusOK, dynatrace.DefaultClient().CacheStats(), "cache stats")
+	}).Methods("GET")
+
 	srv := &http.Server{
-		Addr:         "0.0.0.0:8080",
-		WriteTimeout: time.Second * 15,
-		ReadTimeout:  time.Second * 15,
-		IdleTimeout:  time.Second * 60,
+		Addr:         net.JoinHostPort(config.ListenAddress, strconv.Itoa(config.Port)),
+		WriteTimeout: time.Second * time.Duration(config.WriteTimeoutSecs),
+		ReadTimeout:  time.Second * time.Duration(config.ReadTimeoutSecs),
+		IdleTimeout:  time.Second * time.Duration(config.IdleTimeoutSecs),
 		Handler:      r,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
 	}
 
 	go func() {
@@ -84,10 +444,34 @@ func main() {
 	signal.Notify(c, os.Interrupt)
 	<-c
 
-	// Create a deadline to wait for.
+	// Stop any evaluations which are still running, then create a deadline to wait for.
+	cancelRequests()
 	ctx, cancel := context.WithTimeout(context.Background(), wait)
 	defer cancel()
 	srv.Shutdown(ctx)
+	if store != nil {
+		store.Close()
+	}
 	logging.LogInfo(datatypes.Logging{Message: "Shutting down goDynaPerfSignature."})
 	os.Exit(0)
 }
+
+// writeHistoryUnavailable responds to history requests when the history file couldn't be opened at startup
+func writeHistoryUnavailable(w http.ResponseWriter) {
+	response := datatypes.PerformanceSignatureReturn{
+		Error:     true,
+		ErrorCode: datatypes.ErrorCodeInternal,
+		Response:  []string{"The history is unavailable. Set DT_HISTORY_FILE to keep evaluations, and check that its file can be opened"},
+	}
+	utils.WriteResponse(w, response, datatypes.PerformanceSignature{})
+}
+
+// writeSignatureError responds to a request to /signatures which couldn't be served
+func writeSignatureError(w http.ResponseWriter, errorCode string, message string) {
+	response := datatypes.PerformanceSignatureReturn{
+		Error:     true,
+		ErrorCode: errorCode,
+		Response:  []string{message},
+	}
+	utils.WriteResponse(w, response, datatypes.PerformanceSignature{})
+}
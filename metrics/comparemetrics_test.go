@@ -55,7 +55,7 @@ func TestCheckRelativeThreshold(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.Name, func(t *testing.T) {
-			successText, err := CheckRelativeThreshold(test.Values.Curr, test.Values.Prev, test.Values.Threshold, "dummy_metric_name:(avg)")
+			successText, err := CheckRelativeThreshold(test.Values.Curr, test.Values.Prev, test.Values.Threshold, "", "dummy_metric_name:(avg)")
 
 			if test.ExpectPass == true {
 				assert.NoError(t, err)
@@ -105,7 +105,7 @@ func TestCheckStaticThreshold(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.Name, func(t *testing.T) {
-			message, err := CheckStaticThreshold(test.Values.Metric, test.Values.Threshold, "dummy_metric_name:(avg)")
+			message, err := CheckStaticThreshold(test.Values.Metric, test.Values.Threshold, "", "dummy_metric_name:(avg)")
 
 			if test.ExpectPass == true {
 				assert.NoError(t, err)
@@ -152,7 +152,7 @@ func TestCompareMetrics(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.Name, func(t *testing.T) {
-			message, err := CompareMetrics(test.Values.Curr, test.Values.Prev, "dummy_metric_name:(avg)")
+			message, err := CompareMetrics(test.Values.Curr, test.Values.Prev, "", "dummy_metric_name:(avg)")
 
 			if test.ExpectPass == true {
 				assert.NoError(t, err)
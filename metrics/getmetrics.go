@@ -1,132 +1,202 @@
 package metrics
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"net/url"
-	"time"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/dynatrace"
 	"github.com/barrebre/goDynaPerfSignature/logging"
 )
 
+const (
+	// maxConcurrentQueries bounds how many metric queries are sent to Dynatrace at once
+	maxConcurrentQueries = 4
+
+	// maxSelectorsPerQuery is the most metrics Dynatrace accepts in a single metricSelector
+	maxSelectorsPerQuery = 10
+
+	// maxSelectorLength keeps the escaped metricSelector short enough that the whole URL stays within the limits of
+	// Dynatrace and any proxies in between
+	maxSelectorLength = 4000
+)
+
 // GetMetrics retrieves the metrics from both Deployment Event times in Dynatrace
-func GetMetrics(ps datatypes.PerformanceSignature, ts []datatypes.Timestamps) (datatypes.ComparisonMetrics, error) {
-	metricString := createMetricString(ps.PSMetrics)
-	logging.LogDebug(datatypes.Logging{Message: fmt.Sprintf("Escaped safe metric names are: %v", metricString)})
+func GetMetrics(ctx context.Context, ps datatypes.PerformanceSignature, ts []datatypes.Timestamps) (datatypes.ComparisonMetrics, error) {
+	queries := buildMetricQueries(ps)
+
+	// Look up the units while the windows are queried
+	units := make(chan map[string]string, 1)
+	go func() {
+		units <- getMetricUnits(ctx, ps)
+	}()
 
-	// Get the metrics from the most recent Deployment Event
-	metricResponse, err := queryMetrics(ps.DTServer, ps.DTEnv, metricString, ts[0], ps)
+	// Query every window at once. The responses come back in the same order as the windows
+	metricResponses, err := queryWindows(ctx, ps, queries, ts)
 	if err != nil {
-		return datatypes.ComparisonMetrics{}, fmt.Errorf("error querying current metrics from Dynatrace: %v", err)
+		return datatypes.ComparisonMetrics{}, err
 	}
 
-	// If there were two Deployment Events, get the second set of metrics
-	if len(ts) == 2 {
-		previousMetricResponse, err := queryMetrics(ps.DTServer, ps.DTEnv, metricString, ts[1], ps)
-		if err != nil {
-			return datatypes.ComparisonMetrics{}, fmt.Errorf("error querying previous metrics from Dynatrace: %v", err)
-		}
-		var bothMetricSets = datatypes.ComparisonMetrics{
-			CurrentMetrics:  metricResponse,
-			PreviousMetrics: previousMetricResponse,
-		}
-
-		return bothMetricSets, nil
+	var metrics = datatypes.ComparisonMetrics{
+		CurrentMetrics: metricResponses[0],
+		Units:          <-units,
 	}
 
-	var metrics = datatypes.ComparisonMetrics{
-		CurrentMetrics: metricResponse,
+	// If there were two Deployment Events, include the second set of metrics
+	if len(metricResponses) >= 2 {
+		metrics.PreviousMetrics = metricResponses[1]
 	}
 
 	return metrics, nil
 }
 
-// Transform the POSTed metrics into escaped strings
-func createMetricString(metricNames map[string]datatypes.PSMetric) string {
-	metricString := ""
-	for name := range metricNames {
-		metricString += name + ","
+// metricQuery is a set of metrics which share a resolution, so they can be queried together
+type metricQuery struct {
+	metricString string
+	resolution   string
+}
+
+// buildMetricQueries groups the metrics by the resolution they are queried with, splitting each group into batches
+// which stay within the Dynatrace selector limits
+func buildMetricQueries(ps datatypes.PerformanceSignature) []metricQuery {
+	groups := map[string][]string{}
+	for name, metric := range ps.PSMetrics {
+		resolution := MetricResolution(ps, metric)
+		groups[resolution] = append(groups[resolution], name)
 	}
-	logging.LogDebug(datatypes.Logging{Message: fmt.Sprintf("Safe metric names are: %v", metricString)})
 
-	return metricString
+	// Sort the resolutions so the queries are the same for every request with the same metrics
+	var resolutions []string
+	for resolution := range groups {
+		resolutions = append(resolutions, resolution)
+	}
+	sort.Strings(resolutions)
+
+	var queries []metricQuery
+	for _, resolution := range resolutions {
+		for _, batch := range batchMetricNames(groups[resolution]) {
+			metricString := createMetricString(batch)
+			logging.LogDebug(datatypes.Logging{Message: fmt.Sprintf("Escaped safe metric names at resolution %v are: %v", resolution, metricString)})
+			queries = append(queries, metricQuery{metricString: metricString, resolution: resolution})
+		}
+	}
+
+	return queries
 }
 
-// queryMetrics actually performs the HTTP request to Dynatrace to get the metrics
-func queryMetrics(server string, env string, metricString string, ts datatypes.Timestamps, ps datatypes.PerformanceSignature) (datatypes.DynatraceMetricsResponse, error) {
-	url := buildMetricsQueryURL(server, env, metricString, ts, ps)
+// batchMetricNames splits the metric names into batches with at most maxSelectorsPerQuery metrics each, and whose
+// escaped selector fits in maxSelectorLength. A single metric which is longer than that gets a batch of its own
+func batchMetricNames(names []string) [][]string {
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+
+	var batches [][]string
+	var batch []string
+	length := 0
+	for _, name := range sorted {
+		// Every metric after the first is preceded by an escaped comma
+		nameLength := len(url.QueryEscape(name))
+		if len(batch) > 0 {
+			nameLength += len(url.QueryEscape(","))
+		}
 
-	// Build the request object
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Error creating request handler: %v.", err)})
-		return datatypes.DynatraceMetricsResponse{}, err
-	}
+		if len(batch) > 0 && (len(batch) >= maxSelectorsPerQuery || length+nameLength > maxSelectorLength) {
+			batches = append(batches, batch)
+			batch = nil
+			length = 0
+			nameLength = len(url.QueryEscape(name))
+		}
 
-	// Set the API token
-	apiTokenField := fmt.Sprintf("Api-Token %v", ps.APIToken)
-	req.Header.Add("Authorization", apiTokenField)
-	client := &http.Client{
-		Timeout: time.Second * 10,
+		batch = append(batch, name)
+		length += nameLength
 	}
 
-	// Perform the request
-	r, err := client.Do(req)
-	if err != nil {
-		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Error reading metric data from Dynatrace: %v", err)})
-		return datatypes.DynatraceMetricsResponse{}, err
+	if len(batch) > 0 {
+		batches = append(batches, batch)
 	}
+	return batches
+}
 
-	// Read in the body
-	b, err := ioutil.ReadAll(r.Body)
-	defer r.Body.Close()
-	if err != nil {
-		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Could not read response body from Dynatrace: %v", err.Error())})
-		return datatypes.DynatraceMetricsResponse{}, fmt.Errorf("could not read response body from Dynatrace: %v", err.Error())
+// queryWindows runs every query against every window in parallel with bounded concurrency, merging the results of
+// each window. The first failure cancels the remaining queries
+func queryWindows(ctx context.Context, ps datatypes.PerformanceSignature, queries []metricQuery, ts []datatypes.Timestamps) ([]datatypes.DynatraceMetricsResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Each query keeps its own slot, so the merged results are in the same order for every request
+	results := make([][]datatypes.DynatraceMetricsResponse, len(ts))
+	for i := range results {
+		results[i] = make([]datatypes.DynatraceMetricsResponse, len(queries))
 	}
-	logging.LogDebug(datatypes.Logging{Message: fmt.Sprintf("Full response from Dynatrace is: %v.", string(b))})
+	semaphore := make(chan struct{}, maxConcurrentQueries)
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	for i, window := range ts {
+		for j, query := range queries {
+			wg.Add(1)
+			go func(i int, window datatypes.Timestamps, j int, query metricQuery) {
+				defer wg.Done()
+
+				select {
+				case semaphore <- struct{}{}:
+					defer func() { <-semaphore }()
+				case <-ctx.Done():
+					return
+				}
+
+				metricResponse, err := dynatrace.DefaultClient().QueryMetrics(ctx, dynatrace.EnvironmentFor(ps), dynatrace.MetricsQuery{
+					MetricSelector: query.metricString,
+					EntityID:       ps.ServiceID,
+					From:           window.StartTime,
+					To:             window.EndTime,
+					Resolution:     query.resolution,
+				})
+				if err != nil {
+					once.Do(func() {
+						firstErr = fmt.Errorf("error querying %v metrics from Dynatrace: %w", windowName(i), err)
+						cancel()
+					})
+					return
+				}
+				results[i][j] = metricResponse
+			}(i, window, j, query)
+		}
+	}
+	wg.Wait()
 
-	// Check the status code
-	if r.StatusCode != 200 {
-		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Invalid status code from Dynatrace: %v. Message is '%v'", r.StatusCode, string(b))})
-		return datatypes.DynatraceMetricsResponse{}, fmt.Errorf("invalid status code from Dynatrace: %v", r.StatusCode)
+	if firstErr != nil {
+		return []datatypes.DynatraceMetricsResponse{}, firstErr
 	}
 
-	// Try to parse the response into MetricsResponses
-	var metricsResponse datatypes.DynatraceMetricsResponse
-	err = json.Unmarshal(b, &metricsResponse)
-	if err != nil {
-		return datatypes.DynatraceMetricsResponse{}, err
+	responses := make([]datatypes.DynatraceMetricsResponse, len(ts))
+	for i := range results {
+		for _, result := range results[i] {
+			responses[i].Metrics = append(responses[i].Metrics, result.Metrics...)
+		}
 	}
 
-	return metricsResponse, nil
+	return responses, nil
 }
 
-// buildMetricsQueryURL takes all required params and build the URL which will be queried
-func buildMetricsQueryURL(server string, env string, metricString string, ts datatypes.Timestamps, ps datatypes.PerformanceSignature) string {
-	newURL := url.URL{
-		Scheme: "https",
-		Host:   server,
+// windowName describes a window by its position, with the most recent deployment first
+func windowName(i int) string {
+	if i == 0 {
+		return "current"
 	}
+	return "previous"
+}
 
-	q := newURL.Query()
-	q.Set("metricSelector", metricString)
-	q.Set("resolution", "Inf")
-	q.Set("from", fmt.Sprint(ts.StartTime))
-	q.Set("to", fmt.Sprint(ts.EndTime))
-	q.Set("entitySelector", fmt.Sprintf("entityId(\"%v\")", ps.ServiceID))
-	newURL.RawQuery = q.Encode()
-
-	// Check if there's a Dynatrace environment specified
-	if env == "" {
-		newURL.Path = "api/v2/metrics/query"
-	} else {
-		newURL.Path = fmt.Sprintf("/e/%v/api/v2/metrics/query", env)
-	}
-	logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Built URL: %v", newURL.String())})
+// Transform the POSTed metrics into a single metric selector
+func createMetricString(metricNames []string) string {
+	metricString := strings.Join(metricNames, ",")
+	logging.LogDebug(datatypes.Logging{Message: fmt.Sprintf("Safe metric names are: %v", metricString)})
 
-	return newURL.String()
+	return metricString
 }
@@ -1,27 +1,36 @@
 package metrics
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/dynatrace"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCreateMetricString(t *testing.T) {
 	type testDefs struct {
 		Name   string
-		Input  map[string]datatypes.PSMetric
+		Input  []string
 		Output string
 	}
 
 	tests := []testDefs{
 		{
-			Name: "Metric degradation",
-			Input: map[string]datatypes.PSMetric{
-				"metric1": {},
-				"metric2": {},
-			},
-			Output: "metric1,metric2,",
+			Name:   "Metric degradation",
+			Input:  []string{"metric1", "metric2"},
+			Output: "metric1,metric2",
+		},
+		{
+			Name:   "Single metric",
+			Input:  []string{"metric1"},
+			Output: "metric1",
 		},
 	}
 
@@ -34,50 +43,160 @@ func TestCreateMetricString(t *testing.T) {
 	}
 }
 
-func TestBuildMetricsQueryURL(t *testing.T) {
-	type inputs struct {
-		Server       string
-		Env          string
-		MetricString string
-		TS           datatypes.Timestamps
-		PS           datatypes.PerformanceSignature
+func TestBuildMetricQueries(t *testing.T) {
+	ps := datatypes.PerformanceSignature{
+		PSMetrics: map[string]datatypes.PSMetric{
+			"metric1":     {},
+			"metric2":     {Resolution: "1m"},
+			"metric3":     {},
+			"metric4:max": {Resolution: "1m", SeriesAggregation: "max"},
+		},
+	}
+
+	expected := []metricQuery{
+		{metricString: "metric2,metric4:max", resolution: "1m"},
+		{metricString: "metric1,metric3", resolution: "Inf"},
 	}
 
+	assert.Equal(t, expected, buildMetricQueries(ps))
+}
+
+func TestBatchMetricNames(t *testing.T) {
 	type testDefs struct {
-		Name   string
-		Input  inputs
-		Output string
+		Name            string
+		Names           []string
+		ExpectedBatches []int
+	}
+
+	var many []string
+	for i := 0; i < 25; i++ {
+		many = append(many, fmt.Sprintf("builtin:service.metric%02d:avg", i))
+	}
+
+	var long []string
+	for i := 0; i < 4; i++ {
+		long = append(long, fmt.Sprintf("builtin:service.response.time:filter(eq(\"dt.entity.service\",\"%v%v\")):avg", i, strings.Repeat("x", 1500)))
+	}
+
+	tests := []testDefs{
+		{
+			Name:            "Fits in one batch",
+			Names:           many[:10],
+			ExpectedBatches: []int{10},
+		},
+		{
+			Name:            "Too many selectors",
+			Names:           many,
+			ExpectedBatches: []int{10, 10, 5},
+		},
+		{
+			Name:            "Selectors too long for one URL",
+			Names:           long,
+			ExpectedBatches: []int{2, 2},
+		},
+		{
+			Name:            "A selector longer than the limit gets its own batch",
+			Names:           []string{"a", strings.Repeat("b", maxSelectorLength+1), "c"},
+			ExpectedBatches: []int{1, 1, 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			batches := batchMetricNames(test.Names)
+
+			var sizes []int
+			var all []string
+			for _, batch := range batches {
+				sizes = append(sizes, len(batch))
+				all = append(all, batch...)
+				if len(batch) > 1 {
+					assert.True(t, len(url.QueryEscape(createMetricString(batch))) <= maxSelectorLength)
+				}
+			}
+			assert.Equal(t, test.ExpectedBatches, sizes)
+			assert.ElementsMatch(t, test.Names, all)
+		})
+	}
+}
+
+func TestQueryWindowsMergesBatches(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Answer with one result per selector in the batch, named after the window it was queried for
+		var results []string
+		for _, selector := range strings.Split(r.URL.Query().Get("metricSelector"), ",") {
+			results = append(results, fmt.Sprintf(`{"metricId":"%v","data":[{"dimensions":[],"timestamps":[%v],"values":[1]}]}`, selector, r.URL.Query().Get("from")))
+		}
+		w.Write([]byte(fmt.Sprintf(`{"result":[%v]}`, strings.Join(results, ","))))
+	}))
+	defer server.Close()
+
+	previousClient := dynatrace.DefaultClient()
+	dynatrace.SetDefaultClient(dynatrace.NewClientWithHTTP(server.Client()))
+	defer dynatrace.SetDefaultClient(previousClient)
+
+	ps := datatypes.GetValidStaticPerformanceSignature()
+	ps.DTServer = strings.TrimPrefix(server.URL, "https://")
+	queries := []metricQuery{
+		{metricString: "metric1,metric2", resolution: "Inf"},
+		{metricString: "metric3", resolution: "Inf"},
+	}
+	windows := []datatypes.Timestamps{{StartTime: 1000, EndTime: 2000}, {StartTime: 3000, EndTime: 4000}}
+
+	responses, err := queryWindows(context.Background(), ps, queries, windows)
+
+	assert.NoError(t, err)
+	assert.Len(t, responses, 2)
+	for i, response := range responses {
+		var ids []string
+		for _, metric := range response.Metrics {
+			ids = append(ids, metric.MetricId)
+			assert.Equal(t, windows[i].StartTime, metric.MetricValues[0].Timestamps[0])
+		}
+		assert.Equal(t, []string{"metric1", "metric2", "metric3"}, ids)
+	}
+}
+
+func TestQueryWindows(t *testing.T) {
+	type testDefs struct {
+		Name          string
+		Windows       []datatypes.Timestamps
+		ExpectedError string
 	}
 
 	tests := []testDefs{
 		{
-			Name: "Query with ENV",
-			Input: inputs{
-				Server:       "myserv",
-				Env:          "env1234",
-				MetricString: "builtin:service.response.time:(avg),builtin:service.errors.total.rate:(avg),",
-				TS:           datatypes.GetSingleTimestamp(),
-				PS:           datatypes.GetValidStaticPerformanceSignature(),
-			},
-			Output: "https://myserv/e/env1234/api/v2/metrics/query?entitySelector=entityId%28%22asdf%22%29&from=1234&metricSelector=builtin%3Aservice.response.time%3A%28avg%29%2Cbuiltin%3Aservice.errors.total.rate%3A%28avg%29%2C&resolution=Inf&to=2345",
+			Name:          "Current window fails",
+			Windows:       datatypes.GetSingleTimestamps(),
+			ExpectedError: "error querying current metrics from Dynatrace: ",
 		},
 		{
-			Name: "Query without ENV",
-			Input: inputs{
-				Server:       "myserv",
-				MetricString: "builtin:service.response.time:(avg),builtin:service.errors.total.rate:(avg),",
-				TS:           datatypes.GetSingleTimestamp(),
-				PS:           datatypes.GetValidStaticPerformanceSignature(),
-			},
-			Output: "https://myserv/api/v2/metrics/query?entitySelector=entityId%28%22asdf%22%29&from=1234&metricSelector=builtin%3Aservice.response.time%3A%28avg%29%2Cbuiltin%3Aservice.errors.total.rate%3A%28avg%29%2C&resolution=Inf&to=2345",
+			Name:          "Both windows fail",
+			Windows:       datatypes.GetMultipleTimestamps(),
+			ExpectedError: "error querying ",
 		},
 	}
 
+	// Don't retry, so the failures come back right away
+	client, _ := dynatrace.NewClient(datatypes.Config{})
+	dynatrace.SetDefaultClient(client)
+
 	for _, test := range tests {
 		t.Run(test.Name, func(t *testing.T) {
-			metricQueryURL := buildMetricsQueryURL(test.Input.Server, test.Input.Env, test.Input.MetricString, test.Input.TS, test.Input.PS)
+			// Nothing listens on port 1, so every query fails
+			ps := datatypes.GetValidStaticPerformanceSignature()
+			ps.DTServer = "127.0.0.1:1"
+
+			responses, err := queryWindows(context.Background(), ps, []metricQuery{{metricString: "metric1", resolution: "Inf"}}, test.Windows)
 
-			assert.Equal(t, test.Output, metricQueryURL)
+			assert.Error(t, err)
+			assert.True(t, strings.HasPrefix(err.Error(), test.ExpectedError), err.Error())
+			assert.Empty(t, responses)
 		})
 	}
 }
+
+func TestWindowName(t *testing.T) {
+	assert.Equal(t, "current", windowName(0))
+	assert.Equal(t, "previous", windowName(1))
+}
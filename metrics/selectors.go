@@ -0,0 +1,72 @@
+package metrics
+
+import "strings"
+
+// aggregations are the metric selector transformations which pick how a metric is aggregated
+var aggregations = map[string]bool{
+	"auto": true, "avg": true, "count": true, "max": true, "median": true,
+	"min": true, "percentile": true, "sum": true, "value": true,
+}
+
+// transformations are the other metric selector transformations. Anything before the first transformation or
+// aggregation is the metric key
+var transformations = map[string]bool{
+	"default": true, "delta": true, "filter": true, "fold": true, "last": true, "lastReal": true,
+	"limit": true, "merge": true, "names": true, "parents": true, "partition": true, "rate": true,
+	"rollup": true, "setUnit": true, "smooth": true, "sort": true, "splitBy": true, "timeshift": true,
+	"toUnit": true,
+}
+
+// ParseMetricSelector splits a metric selector into its metric key and the aggregation it requests, if any. Both
+// builtin:service.response.time:avg and builtin:service.response.time:(avg) are understood
+func ParseMetricSelector(selector string) (string, string) {
+	var keyParts []string
+	aggregation := ""
+	keyDone := false
+
+	for _, part := range splitSelector(selector) {
+		name := strings.TrimPrefix(part, "(")
+		if i := strings.Index(name, "("); i >= 0 {
+			name = name[:i]
+		}
+		name = strings.TrimSuffix(name, ")")
+
+		if aggregations[name] || transformations[name] {
+			keyDone = true
+		}
+		if !keyDone {
+			keyParts = append(keyParts, part)
+			continue
+		}
+		if aggregations[name] && aggregation == "" {
+			aggregation = name
+		}
+	}
+
+	return strings.Join(keyParts, ":"), aggregation
+}
+
+// splitSelector splits a metric selector on the colons which are not inside parentheses or quotes
+func splitSelector(selector string) []string {
+	var parts []string
+	depth := 0
+	quoted := false
+	start := 0
+
+	for i, c := range selector {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ':' && depth == 0:
+			parts = append(parts, selector[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, selector[start:])
+}
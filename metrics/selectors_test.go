@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMetricSelector(t *testing.T) {
+	type testDefs struct {
+		Selector            string
+		ExpectedKey         string
+		ExpectedAggregation string
+	}
+
+	tests := []testDefs{
+		{Selector: "builtin:service.response.time", ExpectedKey: "builtin:service.response.time"},
+		{Selector: "builtin:service.response.time:avg", ExpectedKey: "builtin:service.response.time", ExpectedAggregation: "avg"},
+		{Selector: "builtin:service.response.time:(avg)", ExpectedKey: "builtin:service.response.time", ExpectedAggregation: "avg"},
+		{Selector: "dummy_metric_name:percentile(90)", ExpectedKey: "dummy_metric_name", ExpectedAggregation: "percentile"},
+		{Selector: `builtin:service.errors.total.rate:filter(eq("dt.entity.service","a:b")):max`, ExpectedKey: "builtin:service.errors.total.rate", ExpectedAggregation: "max"},
+		{Selector: "builtin:service.requestCount.total:splitBy():sum", ExpectedKey: "builtin:service.requestCount.total", ExpectedAggregation: "sum"},
+		{Selector: ":avg", ExpectedKey: "", ExpectedAggregation: "avg"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Selector, func(t *testing.T) {
+			key, aggregation := ParseMetricSelector(test.Selector)
+
+			assert.Equal(t, test.ExpectedKey, key)
+			assert.Equal(t, test.ExpectedAggregation, aggregation)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+)
+
+const (
+	// defaultResolution asks Dynatrace for a single data point covering the whole window
+	defaultResolution = "Inf"
+
+	// defaultSeriesAggregation averages the data points of a window
+	defaultSeriesAggregation = "avg"
+)
+
+// resolutionPattern matches the resolutions Dynatrace accepts: Inf, a number of data points, or a timespan
+var resolutionPattern = regexp.MustCompile(`^(Inf|[0-9]+|[0-9]+[smhdwMqy])$`)
+
+// percentilePattern matches series aggregations like p95
+var percentilePattern = regexp.MustCompile(`^p([0-9]{1,2})$`)
+
+// MetricResolution returns the resolution a metric is queried with. The metric's own setting wins over the request's
+func MetricResolution(ps datatypes.PerformanceSignature, metric datatypes.PSMetric) string {
+	if metric.Resolution != "" {
+		return metric.Resolution
+	}
+	if ps.Resolution != "" {
+		return ps.Resolution
+	}
+	return defaultResolution
+}
+
+// MetricSeriesAggregation returns how the data points of a metric are collapsed into a single value. The metric's own
+// setting wins over the request's
+func MetricSeriesAggregation(ps datatypes.PerformanceSignature, metric datatypes.PSMetric) string {
+	if metric.SeriesAggregation != "" {
+		return metric.SeriesAggregation
+	}
+	if ps.SeriesAggregation != "" {
+		return ps.SeriesAggregation
+	}
+	return defaultSeriesAggregation
+}
+
+// IsValidResolution checks whether Dynatrace will accept a resolution
+func IsValidResolution(resolution string) bool {
+	return resolution == "" || resolutionPattern.MatchString(resolution)
+}
+
+// IsValidSeriesAggregation checks whether a series aggregation is one we know how to calculate
+func IsValidSeriesAggregation(aggregation string) bool {
+	switch aggregation {
+	case "", "avg", "last", "max", "min":
+		return true
+	}
+
+	match := percentilePattern.FindStringSubmatch(aggregation)
+	if match == nil {
+		return false
+	}
+	percentile, _ := strconv.Atoi(match[1])
+	return percentile >= 1
+}
+
+// CollapseValues reduces the data points of a window to a single value
+func CollapseValues(values []float64, aggregation string) (float64, error) {
+	if len(values) < 1 {
+		return 0, fmt.Errorf("there are no data points to aggregate")
+	}
+
+	switch aggregation {
+	case "", "avg":
+		sum := 0.0
+		for _, value := range values {
+			sum += value
+		}
+		return sum / float64(len(values)), nil
+	case "last":
+		return values[len(values)-1], nil
+	case "max":
+		max := values[0]
+		for _, value := range values[1:] {
+			max = math.Max(max, value)
+		}
+		return max, nil
+	case "min":
+		min := values[0]
+		for _, value := range values[1:] {
+			min = math.Min(min, value)
+		}
+		return min, nil
+	}
+
+	match := percentilePattern.FindStringSubmatch(aggregation)
+	if match == nil {
+		return 0, fmt.Errorf("unknown series aggregation '%v'", aggregation)
+	}
+	percentile, _ := strconv.Atoi(match[1])
+
+	// Use the nearest rank, so the result is always one of the data points
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(float64(percentile) / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1], nil
+}
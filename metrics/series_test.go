@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollapseValues(t *testing.T) {
+	type testDefs struct {
+		Name          string
+		Values        []float64
+		Aggregation   string
+		ExpectPass    bool
+		ExpectedValue float64
+		ExpectedError string
+	}
+
+	values := []float64{40, 10, 30, 20, 100}
+
+	tests := []testDefs{
+		{Name: "Default is avg", Values: values, ExpectPass: true, ExpectedValue: 40},
+		{Name: "avg", Values: values, Aggregation: "avg", ExpectPass: true, ExpectedValue: 40},
+		{Name: "max", Values: values, Aggregation: "max", ExpectPass: true, ExpectedValue: 100},
+		{Name: "min", Values: values, Aggregation: "min", ExpectPass: true, ExpectedValue: 10},
+		{Name: "last", Values: values, Aggregation: "last", ExpectPass: true, ExpectedValue: 100},
+		{Name: "p95", Values: values, Aggregation: "p95", ExpectPass: true, ExpectedValue: 100},
+		{Name: "p50", Values: values, Aggregation: "p50", ExpectPass: true, ExpectedValue: 30},
+		{Name: "p1", Values: values, Aggregation: "p1", ExpectPass: true, ExpectedValue: 10},
+		{Name: "Single point", Values: []float64{12.34}, Aggregation: "p95", ExpectPass: true, ExpectedValue: 12.34},
+		{Name: "No points", Values: []float64{}, Aggregation: "avg", ExpectedError: "there are no data points to aggregate"},
+		{Name: "Unknown aggregation", Values: values, Aggregation: "median", ExpectedError: "unknown series aggregation 'median'"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			value, err := CollapseValues(test.Values, test.Aggregation)
+
+			if test.ExpectPass == true {
+				assert.NoError(t, err)
+				assert.Equal(t, test.ExpectedValue, value)
+			} else {
+				assert.EqualError(t, err, test.ExpectedError)
+			}
+		})
+	}
+
+	// The values must not be reordered by a percentile
+	assert.Equal(t, []float64{40, 10, 30, 20, 100}, values)
+}
+
+func TestIsValidResolution(t *testing.T) {
+	for _, resolution := range []string{"", "Inf", "1m", "5m", "1h", "10"} {
+		assert.True(t, IsValidResolution(resolution), resolution)
+	}
+	for _, resolution := range []string{"inf", "m", "1 m", "1.5m", "-1m"} {
+		assert.False(t, IsValidResolution(resolution), resolution)
+	}
+}
+
+func TestIsValidSeriesAggregation(t *testing.T) {
+	for _, aggregation := range []string{"", "avg", "max", "min", "last", "p95", "p5"} {
+		assert.True(t, IsValidSeriesAggregation(aggregation), aggregation)
+	}
+	for _, aggregation := range []string{"median", "p0", "p100", "p", "P95"} {
+		assert.False(t, IsValidSeriesAggregation(aggregation), aggregation)
+	}
+}
+
+func TestMetricSettings(t *testing.T) {
+	ps := datatypes.PerformanceSignature{}
+	assert.Equal(t, "Inf", MetricResolution(ps, datatypes.PSMetric{}))
+	assert.Equal(t, "avg", MetricSeriesAggregation(ps, datatypes.PSMetric{}))
+
+	ps.Resolution = "1m"
+	ps.SeriesAggregation = "max"
+	assert.Equal(t, "1m", MetricResolution(ps, datatypes.PSMetric{}))
+	assert.Equal(t, "max", MetricSeriesAggregation(ps, datatypes.PSMetric{}))
+
+	metric := datatypes.PSMetric{Resolution: "5m", SeriesAggregation: "p95"}
+	assert.Equal(t, "5m", MetricResolution(ps, metric))
+	assert.Equal(t, "p95", MetricSeriesAggregation(ps, metric))
+}
@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/dynatrace"
+	"github.com/barrebre/goDynaPerfSignature/logging"
+)
+
+// unitScale places a unit on a scale, so values can be converted between units of the same kind
+type unitScale struct {
+	kind   string
+	factor float64
+	symbol string
+}
+
+// dynatraceUnits are the Dynatrace metric units we know how to convert and print
+var dynatraceUnits = map[string]unitScale{
+	"NanoSecond":  {kind: "time", factor: 1e-9, symbol: "ns"},
+	"MicroSecond": {kind: "time", factor: 1e-6, symbol: "µs"},
+	"MilliSecond": {kind: "time", factor: 1e-3, symbol: "ms"},
+	"Second":      {kind: "time", factor: 1, symbol: "s"},
+	"Minute":      {kind: "time", factor: 60, symbol: "min"},
+	"Hour":        {kind: "time", factor: 3600, symbol: "h"},
+	"Day":         {kind: "time", factor: 86400, symbol: "d"},
+	"Percent":     {kind: "percent", factor: 1, symbol: "%"},
+	"Byte":        {kind: "bytes", factor: 1, symbol: "B"},
+	"KiloByte":    {kind: "bytes", factor: 1e3, symbol: "KB"},
+	"MegaByte":    {kind: "bytes", factor: 1e6, symbol: "MB"},
+	"GigaByte":    {kind: "bytes", factor: 1e9, symbol: "GB"},
+	"KibiByte":    {kind: "bytes", factor: 1 << 10, symbol: "KiB"},
+	"MebiByte":    {kind: "bytes", factor: 1 << 20, symbol: "MiB"},
+	"GibiByte":    {kind: "bytes", factor: 1 << 30, symbol: "GiB"},
+	"PerSecond":   {kind: "rate", factor: 1, symbol: "/s"},
+	"PerMinute":   {kind: "rate", factor: 1.0 / 60, symbol: "/min"},
+	"PerHour":     {kind: "rate", factor: 1.0 / 3600, symbol: "/h"},
+}
+
+// thresholdUnits maps the units accepted in thresholds to their Dynatrace unit
+var thresholdUnits = map[string]string{
+	"ns":   "NanoSecond",
+	"us":   "MicroSecond",
+	"µs":   "MicroSecond",
+	"ms":   "MilliSecond",
+	"s":    "Second",
+	"m":    "Minute",
+	"min":  "Minute",
+	"h":    "Hour",
+	"d":    "Day",
+	"%":    "Percent",
+	"B":    "Byte",
+	"KB":   "KiloByte",
+	"MB":   "MegaByte",
+	"GB":   "GigaByte",
+	"KiB":  "KibiByte",
+	"MiB":  "MebiByte",
+	"GiB":  "GibiByte",
+	"/s":   "PerSecond",
+	"/min": "PerMinute",
+	"/h":   "PerHour",
+}
+
+// displayUnits are the units a value is scaled to when it is printed, from smallest to largest
+var displayUnits = map[string][]string{
+	"time":  {"NanoSecond", "MicroSecond", "MilliSecond", "Second", "Minute", "Hour"},
+	"bytes": {"Byte", "KiloByte", "MegaByte", "GigaByte"},
+}
+
+// IsKnownThresholdUnit checks whether a threshold unit can be converted
+func IsKnownThresholdUnit(unit string) bool {
+	_, ok := thresholdUnits[unit]
+	return unit == "" || ok
+}
+
+// ConvertThreshold converts a threshold into the unit of the metric it is compared against
+func ConvertThreshold(threshold datatypes.Threshold, metricUnit string) (float64, error) {
+	if threshold.Unit == "" {
+		return threshold.Value, nil
+	}
+
+	from, ok := dynatraceUnits[thresholdUnits[threshold.Unit]]
+	if !ok {
+		return 0, fmt.Errorf("the threshold %v has an unknown unit", threshold)
+	}
+
+	to, ok := dynatraceUnits[metricUnit]
+	if !ok {
+		return 0, fmt.Errorf("the threshold %v has a unit, but the unit of the metric is not known", threshold)
+	}
+
+	if from.kind != to.kind {
+		return 0, fmt.Errorf("the threshold %v can't be compared with a metric measured in %v", threshold, metricUnit)
+	}
+
+	return threshold.Value * from.factor / to.factor, nil
+}
+
+// FormatValue prints a metric value in the most readable form of its unit. Values with an unknown unit are printed
+// as plain numbers
+func FormatValue(value float64, unit string) string {
+	scale, ok := dynatraceUnits[unit]
+	if !ok {
+		return fmt.Sprintf("%.2f", value)
+	}
+
+	if value == 0 {
+		return fmt.Sprintf("%.2f%v", value, scale.symbol)
+	}
+
+	// Pick the largest unit which keeps the value at 1 or above, so 82122µs prints as 82.12ms
+	for i := len(displayUnits[scale.kind]) - 1; i >= 0; i-- {
+		display := dynatraceUnits[displayUnits[scale.kind][i]]
+		scaled := value * scale.factor / display.factor
+		if math.Abs(scaled) >= 1 || i == 0 {
+			return fmt.Sprintf("%.2f%v", scaled, display.symbol)
+		}
+	}
+
+	return fmt.Sprintf("%.2f%v", value, scale.symbol)
+}
+
+// getMetricUnits looks up the unit of every metric from its descriptor. Metrics whose unit can't be found are left
+// out, which only matters for thresholds that were given with a unit
+func getMetricUnits(ctx context.Context, ps datatypes.PerformanceSignature) map[string]string {
+	units := map[string]string{}
+	for selector := range ps.PSMetrics {
+		metricKey, aggregation := ParseMetricSelector(selector)
+
+		// These transformations change the unit, so the descriptor doesn't describe the values we get back
+		if strings.Contains(selector, "toUnit(") || strings.Contains(selector, "setUnit(") || strings.Contains(selector, "rate(") {
+			continue
+		}
+
+		// Counting data points gives a plain number, whatever the metric measures
+		if aggregation == "count" {
+			units[selector] = "Count"
+			continue
+		}
+
+		descriptor, err := dynatrace.DefaultClient().GetMetricDescriptor(ctx, dynatrace.EnvironmentFor(ps), metricKey)
+		if err != nil {
+			logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Couldn't find the unit of %v: %v", selector, err)})
+			continue
+		}
+		units[selector] = descriptor.Unit
+	}
+
+	return units
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertThreshold(t *testing.T) {
+	type testDefs struct {
+		Name          string
+		Threshold     datatypes.Threshold
+		MetricUnit    string
+		ExpectPass    bool
+		ExpectedValue float64
+		ExpectedError string
+	}
+
+	tests := []testDefs{
+		{
+			Name:          "Pass - no unit is used as is",
+			Threshold:     datatypes.Threshold{Value: 500000},
+			MetricUnit:    "MicroSecond",
+			ExpectPass:    true,
+			ExpectedValue: 500000,
+		},
+		{
+			Name:          "Pass - milliseconds to microseconds",
+			Threshold:     datatypes.Threshold{Value: 500, Unit: "ms"},
+			MetricUnit:    "MicroSecond",
+			ExpectPass:    true,
+			ExpectedValue: 500000,
+		},
+		{
+			Name:          "Pass - percent",
+			Threshold:     datatypes.Threshold{Value: 2, Unit: "%"},
+			MetricUnit:    "Percent",
+			ExpectPass:    true,
+			ExpectedValue: 2,
+		},
+		{
+			Name:          "Pass - binary bytes",
+			Threshold:     datatypes.Threshold{Value: 1, Unit: "MiB"},
+			MetricUnit:    "KibiByte",
+			ExpectPass:    true,
+			ExpectedValue: 1024,
+		},
+		{
+			Name:          "Fail - different kinds of unit",
+			Threshold:     datatypes.Threshold{Value: 2, Unit: "%"},
+			MetricUnit:    "MicroSecond",
+			ExpectedError: "the threshold 2% can't be compared with a metric measured in MicroSecond",
+		},
+		{
+			Name:          "Fail - unknown metric unit",
+			Threshold:     datatypes.Threshold{Value: 500, Unit: "ms"},
+			MetricUnit:    "",
+			ExpectedError: "the threshold 500ms has a unit, but the unit of the metric is not known",
+		},
+		{
+			Name:          "Fail - unknown threshold unit",
+			Threshold:     datatypes.Threshold{Value: 5, Unit: "parsecs"},
+			MetricUnit:    "Second",
+			ExpectedError: "the threshold 5parsecs has an unknown unit",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			value, err := ConvertThreshold(test.Threshold, test.MetricUnit)
+
+			if test.ExpectPass == true {
+				assert.NoError(t, err)
+				assert.InDelta(t, test.ExpectedValue, value, 0.000001)
+			} else {
+				assert.EqualError(t, err, test.ExpectedError)
+			}
+		})
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	assert.Equal(t, "1234.12", FormatValue(1234.1234, ""))
+	assert.Equal(t, "1234.12", FormatValue(1234.1234, "Unspecified"))
+	assert.Equal(t, "82.12ms", FormatValue(82122.06, "MicroSecond"))
+	assert.Equal(t, "150.00µs", FormatValue(150, "MicroSecond"))
+	assert.Equal(t, "1.50s", FormatValue(1500, "MilliSecond"))
+	assert.Equal(t, "0.00µs", FormatValue(0, "MicroSecond"))
+	assert.Equal(t, "-2.50ms", FormatValue(-2500, "MicroSecond"))
+	assert.Equal(t, "2.00%", FormatValue(2, "Percent"))
+	assert.Equal(t, "1.50MB", FormatValue(1500, "KiloByte"))
+	assert.Equal(t, "12.00/min", FormatValue(12, "PerMinute"))
+}
+
+func TestIsKnownThresholdUnit(t *testing.T) {
+	assert.True(t, IsKnownThresholdUnit(""))
+	assert.True(t, IsKnownThresholdUnit("ms"))
+	assert.True(t, IsKnownThresholdUnit("%"))
+	assert.False(t, IsKnownThresholdUnit("parsecs"))
+}
@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+)
+
+// ValidatePSMetrics checks the resolution, series aggregation and threshold units of every metric. The metrics are
+// checked in order of their names, so the same metrics always report the same error
+func ValidatePSMetrics(psMetrics map[string]datatypes.PSMetric) error {
+	var names []string
+	for name := range psMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		metric := psMetrics[name]
+		if !IsValidResolution(metric.Resolution) {
+			return fmt.Errorf("the Resolution '%v' of %v must be Inf, a number of data points, or a timespan like 1m", metric.Resolution, name)
+		}
+		if !IsValidSeriesAggregation(metric.SeriesAggregation) {
+			return fmt.Errorf("the SeriesAggregation '%v' of %v must be avg, min, max, last, or a percentile like p95", metric.SeriesAggregation, name)
+		}
+
+		if !IsKnownThresholdUnit(metric.StaticThreshold.Unit) {
+			return fmt.Errorf("the StaticThreshold of %v has an unknown unit '%v'", name, metric.StaticThreshold.Unit)
+		}
+		if !IsKnownThresholdUnit(metric.RelativeThreshold.Unit) {
+			return fmt.Errorf("the RelativeThreshold of %v has an unknown unit '%v'", name, metric.RelativeThreshold.Unit)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePSMetrics(t *testing.T) {
+	type testDefs struct {
+		Name          string
+		PSMetrics     map[string]datatypes.PSMetric
+		ExpectPass    bool
+		ExpectedError string
+	}
+
+	tests := []testDefs{
+		{
+			Name: "Valid metrics",
+			PSMetrics: map[string]datatypes.PSMetric{
+				"builtin:service.response.time:avg":     {Resolution: "1m", SeriesAggregation: "p95", StaticThreshold: datatypes.Threshold{Value: 500, Unit: "ms"}},
+				"builtin:service.errors.total.rate:avg": {RelativeThreshold: datatypes.Threshold{Value: 2, Unit: "%"}},
+			},
+			ExpectPass: true,
+		},
+		{
+			Name: "Invalid resolution",
+			PSMetrics: map[string]datatypes.PSMetric{
+				"builtin:service.response.time:avg": {Resolution: "1 minute"},
+			},
+			ExpectedError: "the Resolution '1 minute' of builtin:service.response.time:avg must be Inf, a number of data points, or a timespan like 1m",
+		},
+		{
+			Name: "Invalid series aggregation",
+			PSMetrics: map[string]datatypes.PSMetric{
+				"builtin:service.response.time:avg": {SeriesAggregation: "worst"},
+			},
+			ExpectedError: "the SeriesAggregation 'worst' of builtin:service.response.time:avg must be avg, min, max, last, or a percentile like p95",
+		},
+		{
+			Name: "Unknown relative threshold unit",
+			PSMetrics: map[string]datatypes.PSMetric{
+				"builtin:service.response.time:avg": {RelativeThreshold: datatypes.Threshold{Value: 1, Unit: "parsecs"}},
+			},
+			ExpectedError: "the RelativeThreshold of builtin:service.response.time:avg has an unknown unit 'parsecs'",
+		},
+		{
+			Name: "The first invalid metric by name is reported",
+			PSMetrics: map[string]datatypes.PSMetric{
+				"metric2": {Resolution: "bad2"},
+				"metric1": {Resolution: "bad1"},
+			},
+			ExpectedError: "the Resolution 'bad1' of metric1 must be Inf, a number of data points, or a timespan like 1m",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			err := ValidatePSMetrics(test.PSMetrics)
+
+			if test.ExpectPass {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.ExpectedError)
+			}
+		})
+	}
+}
@@ -1,55 +1,30 @@
 package performancesignature
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"time"
 
 	"github.com/barrebre/goDynaPerfSignature/datatypes"
 	"github.com/barrebre/goDynaPerfSignature/logging"
 )
 
-// Gets the deployment events from Dynatrace
-func getDeploymentEvents(req http.Request) (datatypes.DeploymentEvents, error) {
-	client := &http.Client{
-		Timeout: time.Second * 10,
-	}
-
-	// Perform the request
-	r, err := client.Do(&req)
-	if err != nil {
-		logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Error reading Deployment Event data from Dynatrace: %v", err)})
-		return datatypes.DeploymentEvents{}, err
-	}
-
-	// Read in the body
-	b, err := ioutil.ReadAll(r.Body)
-	defer r.Body.Close()
-	if err != nil {
-		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Could not read response body from Dynatrace: %v", err.Error())})
-		return datatypes.DeploymentEvents{}, fmt.Errorf("could not read response body from Dynatrace: %v", err.Error())
-	}
+// dataLatencyBuffer is how long to wait after a window closes for Dynatrace to finish ingesting its data
+const dataLatencyBuffer = 2 * time.Minute
 
-	// Check the status code
-	if r.StatusCode != 200 {
-		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Invalid status code from Dynatrace: %v. Body message is '%v'\n", r.StatusCode, string(b))})
-		return datatypes.DeploymentEvents{}, fmt.Errorf("invalid status code from Dynatrace: %v", r.StatusCode)
-	}
-
-	// Try to parse the response into DeploymentEvents
-	var deploymentEvents datatypes.DeploymentEvents
-	err = json.Unmarshal(b, &deploymentEvents)
-	if err != nil {
-		return datatypes.DeploymentEvents{}, err
-	}
+// incompleteWindowError is returned when an evaluation window has not finished yet, or finished too recently for
+// Dynatrace to have ingested its data
+type incompleteWindowError struct {
+	StartTime int64
+	EndTime   int64
+	ReadyAt   time.Time
+}
 
-	return deploymentEvents, nil
+func (e *incompleteWindowError) Error() string {
+	return fmt.Sprintf("the evaluation window from %v to %v has not finished, or its data is still being ingested", e.StartTime, e.EndTime)
 }
 
 // Parses Dynatrace Deployment Events for their timestamps
-func parseDeploymentTimestamps(d datatypes.DeploymentEvents, mins int) ([]datatypes.Timestamps, error) {
+func parseDeploymentTimestamps(d datatypes.DeploymentEvents, mins int, offsetMins int) ([]datatypes.Timestamps, error) {
 	eventsFound := len(d.Events)
 
 	// If there are no deployment events previously, we can still perform static checks
@@ -58,57 +33,84 @@ func parseDeploymentTimestamps(d datatypes.DeploymentEvents, mins int) ([]dataty
 		return []datatypes.Timestamps{}, nil
 		// If there is only one deployment event, we can still perform static checks
 	} else if eventsFound == 1 {
-		var deploymentTimestamp []datatypes.Timestamps
-
-		// If there is no evaluation timeframe supplied
-		if mins < 1 {
-			deploymentTimestamp = []datatypes.Timestamps{
-				{
-					StartTime: d.Events[0].StartTime,
-					EndTime:   d.Events[0].EndTime,
-				},
-			}
-		} else {
-			microMins := int64(mins * 60000)
-			deploymentTimestamp = []datatypes.Timestamps{
-				{
-					StartTime: d.Events[0].StartTime,
-					EndTime:   d.Events[0].StartTime + microMins,
-				},
-			}
+		deploymentTimestamp := []datatypes.Timestamps{
+			buildDeploymentWindow(d.Events[0], mins, offsetMins),
+		}
+
+		err := validateEvaluationWindows(deploymentTimestamp, time.Now())
+		if err != nil {
+			return []datatypes.Timestamps{}, err
 		}
 		return deploymentTimestamp, nil
 		// If there are two deployment events, we can perform all types of checks
 	} else if eventsFound >= 2 {
-		var deploymentTimestamps []datatypes.Timestamps
-
-		// If there is no evaluation timeframe supplied
-		if mins < 1 {
-			deploymentTimestamps = []datatypes.Timestamps{
-				{
-					StartTime: d.Events[0].StartTime,
-					EndTime:   d.Events[0].EndTime,
-				},
-				{
-					StartTime: d.Events[1].StartTime,
-					EndTime:   d.Events[1].EndTime,
-				},
-			}
-		} else {
-			microMins := int64(mins * 60000)
-			deploymentTimestamps = []datatypes.Timestamps{
-				{
-					StartTime: d.Events[0].StartTime,
-					EndTime:   d.Events[0].StartTime + microMins,
-				},
-				{
-					StartTime: d.Events[1].StartTime,
-					EndTime:   d.Events[1].StartTime + microMins,
-				},
-			}
+		deploymentTimestamps := []datatypes.Timestamps{
+			buildDeploymentWindow(d.Events[0], mins, offsetMins),
+			buildDeploymentWindow(d.Events[1], mins, offsetMins),
+		}
+
+		err := validateEvaluationWindows(deploymentTimestamps, time.Now())
+		if err != nil {
+			return []datatypes.Timestamps{}, err
 		}
 		return deploymentTimestamps, nil
 	}
 
 	return []datatypes.Timestamps{}, fmt.Errorf("wasn't able to read deployments from Dynatrace")
 }
+
+// selectDeploymentEvents drops the Deployment Events newer than the one with correlationID, so that deployment is
+// evaluated against the one before it. Without a correlationID, the latest deployment is evaluated
+func selectDeploymentEvents(d datatypes.DeploymentEvents, correlationID string) (datatypes.DeploymentEvents, error) {
+	if correlationID == "" {
+		return d, nil
+	}
+
+	for i, event := range d.Events {
+		if event.CorrelationID == correlationID {
+			return datatypes.DeploymentEvents{Events: d.Events[i:]}, nil
+		}
+	}
+
+	return datatypes.DeploymentEvents{}, fmt.Errorf("there is no deployment event with the CorrelationID %v within the EventAge", correlationID)
+}
+
+// Builds the window to evaluate for a Deployment Event, skipping the first offsetMins after the deployment
+func buildDeploymentWindow(event datatypes.DeploymentEvent, mins int, offsetMins int) datatypes.Timestamps {
+	startTime := event.StartTime + int64(offsetMins*60000)
+
+	// If there is no evaluation timeframe supplied, evaluate until the end of the event
+	if mins < 1 {
+		return datatypes.Timestamps{
+			StartTime: startTime,
+			EndTime:   event.EndTime,
+		}
+	}
+
+	microMins := int64(mins * 60000)
+	return datatypes.Timestamps{
+		StartTime: startTime,
+		EndTime:   startTime + microMins,
+	}
+}
+
+// Ensures each window is usable and its data is complete. Windows which have not finished at least dataLatencyBuffer
+// ago return an incompleteWindowError so callers can decide to wait for them
+func validateEvaluationWindows(timestamps []datatypes.Timestamps, now time.Time) error {
+	for _, ts := range timestamps {
+		if ts.StartTime > ts.EndTime {
+			return fmt.Errorf("the EvaluationOffsetMins moves the window start (%v) past the end of the deployment event (%v)", ts.StartTime, ts.EndTime)
+		}
+
+		readyAt := time.Unix(0, ts.EndTime*int64(time.Millisecond)).Add(dataLatencyBuffer)
+		if readyAt.After(now) {
+			return &incompleteWindowError{
+				StartTime: ts.StartTime,
+				EndTime:   ts.EndTime,
+				ReadyAt:   readyAt,
+			}
+		}
+	}
+
+	return nil
+}
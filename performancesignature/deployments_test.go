@@ -1,63 +1,20 @@
 package performancesignature
 
 import (
-	"net/http"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/barrebre/goDynaPerfSignature/datatypes"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func TestGetDeploymentEvents(t *testing.T) {
-	type testDefs struct {
-		Name           string
-		Values         http.Request
-		ExpectPass     bool
-		ExpectedError  string
-		ExpectedResult datatypes.DeploymentEvents
-	}
-
-	url := "https://www.google.com"
-	passHTTPReq, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		assert.FailNow(t, "Couldn't query endpoint")
-	}
-
-	tests := []testDefs{
-		{
-			Name:       "Invalid Endpoint",
-			Values:     *passHTTPReq,
-			ExpectPass: false,
-		},
-		{
-			Name:       "Invalid Request",
-			Values:     http.Request{},
-			ExpectPass: false,
-		},
-	}
-
-	for _, test := range tests {
-		t.Run(test.Name, func(t *testing.T) {
-			_, err := getDeploymentEvents(test.Values)
-
-			if test.ExpectPass == true {
-				assert.NoError(t, err)
-			} else {
-				if test.ExpectedError != "" {
-					assert.Equal(t, err.Error(), test.ExpectedError)
-				} else {
-					assert.Error(t, err)
-				}
-			}
-		})
-	}
-}
-
 func TestParseDeploymentTimestamps(t *testing.T) {
 	type TestValues struct {
-		DeploymentEvents datatypes.DeploymentEvents
-		EvaluationMins   int
+		DeploymentEvents     datatypes.DeploymentEvents
+		EvaluationMins       int
+		EvaluationOffsetMins int
 	}
 
 	type testDefs struct {
@@ -68,6 +25,9 @@ func TestParseDeploymentTimestamps(t *testing.T) {
 		ExpectedResult []datatypes.Timestamps
 	}
 
+	futureStart := time.Now().Add(time.Hour).UnixNano() / int64(time.Millisecond)
+	recentStart := time.Now().Add(-5*time.Minute-30*time.Second).UnixNano() / int64(time.Millisecond)
+
 	tests := []testDefs{
 		{
 			Name:           "No Deployment Events",
@@ -131,11 +91,69 @@ func TestParseDeploymentTimestamps(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name: "Two Deployment Events with Eval Time and Offset Set",
+			Values: TestValues{
+				DeploymentEvents:     datatypes.GetMultipleEventDeploymentEvent(),
+				EvaluationMins:       5,
+				EvaluationOffsetMins: 2,
+			},
+			ExpectPass: true,
+			ExpectedResult: []datatypes.Timestamps{
+				{
+					StartTime: 121234,
+					EndTime:   421234,
+				},
+				{
+					StartTime: 121234,
+					EndTime:   421234,
+				},
+			},
+		},
+		{
+			Name: "One Deployment Event with Offset past the end of the event",
+			Values: TestValues{
+				DeploymentEvents:     datatypes.GetSingleEventDeploymentEvent(),
+				EvaluationOffsetMins: 1,
+			},
+			ExpectPass:    false,
+			ExpectedError: "the EvaluationOffsetMins moves the window start (61234) past the end of the deployment event (2345)",
+		},
+		{
+			Name: "One Deployment Event with Eval Time in the future",
+			Values: TestValues{
+				DeploymentEvents: datatypes.DeploymentEvents{
+					Events: []datatypes.DeploymentEvent{
+						{
+							StartTime: futureStart,
+						},
+					},
+				},
+				EvaluationMins: 5,
+			},
+			ExpectPass:    false,
+			ExpectedError: fmt.Sprintf("the evaluation window from %v to %v has not finished, or its data is still being ingested", futureStart, futureStart+300000),
+		},
+		{
+			Name: "One Deployment Event whose window closed within the data latency buffer",
+			Values: TestValues{
+				DeploymentEvents: datatypes.DeploymentEvents{
+					Events: []datatypes.DeploymentEvent{
+						{
+							StartTime: recentStart,
+						},
+					},
+				},
+				EvaluationMins: 5,
+			},
+			ExpectPass:    false,
+			ExpectedError: fmt.Sprintf("the evaluation window from %v to %v has not finished, or its data is still being ingested", recentStart, recentStart+300000),
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.Name, func(t *testing.T) {
-			ts, err := parseDeploymentTimestamps(test.Values.DeploymentEvents, test.Values.EvaluationMins)
+			ts, err := parseDeploymentTimestamps(test.Values.DeploymentEvents, test.Values.EvaluationMins, test.Values.EvaluationOffsetMins)
 
 			if test.ExpectPass == true {
 				if test.ExpectedResult != nil {
@@ -151,3 +169,50 @@ func TestParseDeploymentTimestamps(t *testing.T) {
 		})
 	}
 }
+
+func TestSelectDeploymentEvents(t *testing.T) {
+	events := datatypes.DeploymentEvents{
+		Events: []datatypes.DeploymentEvent{
+			{StartTime: 3, EndTime: 4, CorrelationID: "third"},
+			{StartTime: 2, EndTime: 3, CorrelationID: "second"},
+			{StartTime: 1, EndTime: 2, CorrelationID: "first"},
+		},
+	}
+
+	type testDefs struct {
+		Name           string
+		CorrelationID  string
+		ExpectedError  string
+		ExpectedEvents []datatypes.DeploymentEvent
+	}
+
+	tests := []testDefs{
+		{
+			Name:           "Latest deployment without a correlation ID",
+			ExpectedEvents: events.Events,
+		},
+		{
+			Name:           "Deployment with the correlation ID",
+			CorrelationID:  "second",
+			ExpectedEvents: events.Events[1:],
+		},
+		{
+			Name:          "Unknown correlation ID",
+			CorrelationID: "fourth",
+			ExpectedError: "there is no deployment event with the CorrelationID fourth within the EventAge",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			selected, err := selectDeploymentEvents(events, test.CorrelationID)
+
+			if test.ExpectedError != "" {
+				assert.EqualError(t, err, test.ExpectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.ExpectedEvents, selected.Events)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package performancesignature
+
+import (
+	"context"
+	"sync"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+)
+
+// EvaluationDetails collects the windows and metric values each service was evaluated with, so they can be kept
+// along with the result
+type EvaluationDetails struct {
+	lock     sync.Mutex
+	services []datatypes.ServiceEvaluation
+}
+
+// Services returns what was gathered for each service so far, in the order they were evaluated
+func (d *EvaluationDetails) Services() []datatypes.ServiceEvaluation {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append([]datatypes.ServiceEvaluation{}, d.services...)
+}
+
+type evaluationDetailsKey struct{}
+
+// WithEvaluationDetails returns a context which collects the details of every service evaluated with it
+func WithEvaluationDetails(ctx context.Context) (context.Context, *EvaluationDetails) {
+	details := &EvaluationDetails{}
+	return context.WithValue(ctx, evaluationDetailsKey{}, details), details
+}
+
+// recordServiceEvaluation keeps the details of a service, if the context is collecting them
+func recordServiceEvaluation(ctx context.Context, service datatypes.ServiceEvaluation) {
+	details, ok := ctx.Value(evaluationDetailsKey{}).(*EvaluationDetails)
+	if !ok {
+		return
+	}
+
+	details.lock.Lock()
+	defer details.lock.Unlock()
+	details.services = append(details.services, service)
+}
@@ -0,0 +1,22 @@
+package performancesignature
+
+import (
+	"context"
+	"testing"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluationDetails(t *testing.T) {
+	service := datatypes.GetEvaluationRecord().Services[0]
+
+	// Without a collector, nothing is kept
+	recordServiceEvaluation(context.Background(), service)
+
+	ctx, details := WithEvaluationDetails(context.Background())
+	assert.Empty(t, details.Services())
+
+	recordServiceEvaluation(ctx, service)
+	assert.Equal(t, []datatypes.ServiceEvaluation{service}, details.Services())
+}
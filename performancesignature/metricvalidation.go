@@ -0,0 +1,98 @@
+package performancesignature
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/dynatrace"
+	"github.com/barrebre/goDynaPerfSignature/logging"
+	"github.com/barrebre/goDynaPerfSignature/metrics"
+)
+
+// MetricValidationError lists every metric selector which Dynatrace would not be able to query
+type MetricValidationError struct {
+	// Invalid maps each invalid selector to the reason it is invalid
+	Invalid map[string]string
+}
+
+func (e *MetricValidationError) Error() string {
+	var selectors []string
+	for selector := range e.Invalid {
+		selectors = append(selectors, selector)
+	}
+	sort.Strings(selectors)
+
+	var problems []string
+	for _, selector := range selectors {
+		problems = append(problems, fmt.Sprintf("%v (%v)", selector, e.Invalid[selector]))
+	}
+	return fmt.Sprintf("invalid metric selectors: %v", strings.Join(problems, "; "))
+}
+
+// ValidationErrorCode classifies an error from ReadAndValidateParams
+func ValidationErrorCode(err error) string {
+	var metricErr *MetricValidationError
+	if errors.As(err, &metricErr) {
+		return datatypes.ErrorCodeInvalidMetricSelector
+	}
+
+	// Errors from Dynatrace while looking up the metric descriptors keep their own classification
+	if code := dynatrace.ErrorCode(err); code != datatypes.ErrorCodeInternal {
+		return code
+	}
+
+	return datatypes.ErrorCodeInvalidRequest
+}
+
+// validateMetricSelectors checks every metric selector against its descriptor in Dynatrace, so a typo is reported
+// before anything is evaluated instead of as an empty result
+func validateMetricSelectors(ctx context.Context, ps datatypes.PerformanceSignature) error {
+	invalid := map[string]string{}
+	for selector := range ps.PSMetrics {
+		metricKey, aggregation := metrics.ParseMetricSelector(selector)
+		if metricKey == "" {
+			invalid[selector] = "no metric key found"
+			continue
+		}
+
+		descriptor, err := dynatrace.DefaultClient().GetMetricDescriptor(ctx, dynatrace.EnvironmentFor(ps), metricKey)
+		if err != nil {
+			var apiErr *dynatrace.APIError
+			if errors.As(err, &apiErr) && (apiErr.StatusCode == 400 || apiErr.StatusCode == 404) {
+				invalid[selector] = fmt.Sprintf("metric %v does not exist", metricKey)
+				continue
+			}
+			return fmt.Errorf("couldn't get the descriptor of %v from Dynatrace: %w", metricKey, err)
+		}
+
+		if aggregation != "" && !supportsAggregation(descriptor, aggregation) {
+			invalid[selector] = fmt.Sprintf("metric %v does not support the %v aggregation. Supported aggregations are %v", metricKey, aggregation, strings.Join(descriptor.AggregationTypes, ", "))
+		}
+	}
+
+	if len(invalid) > 0 {
+		return &MetricValidationError{Invalid: invalid}
+	}
+
+	logging.LogDebug(datatypes.Logging{Message: fmt.Sprintf("Validated %v metric selectors", len(ps.PSMetrics))})
+	return nil
+}
+
+// supportsAggregation checks whether a metric can be aggregated the requested way
+func supportsAggregation(descriptor datatypes.MetricDescriptor, aggregation string) bool {
+	// Older descriptors don't list their aggregations, so trust the selector
+	if len(descriptor.AggregationTypes) == 0 {
+		return true
+	}
+
+	for _, supported := range descriptor.AggregationTypes {
+		if strings.EqualFold(supported, aggregation) {
+			return true
+		}
+	}
+	return false
+}
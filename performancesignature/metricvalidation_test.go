@@ -0,0 +1,89 @@
+package performancesignature
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/dynatrace"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMetricSelectors(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/api/v2/metrics/") {
+		case "builtin:service.response.time":
+			w.Write([]byte(`{"metricId":"builtin:service.response.time","aggregationTypes":["auto","avg","max","min","percentile"]}`))
+		case "builtin:service.errors.total.count":
+			w.Write([]byte(`{"metricId":"builtin:service.errors.total.count","aggregationTypes":["auto","value"]}`))
+		case "builtin:forbidden":
+			w.WriteHeader(403)
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte(`{"error":{"code":404,"message":"Metric key not found"}}`))
+		}
+	}))
+	defer server.Close()
+
+	previousClient := dynatrace.DefaultClient()
+	dynatrace.SetDefaultClient(dynatrace.NewClientWithHTTP(server.Client()))
+	defer dynatrace.SetDefaultClient(previousClient)
+
+	type testDefs struct {
+		Name          string
+		Metrics       []string
+		ExpectPass    bool
+		ExpectedError string
+		ExpectedCode  string
+	}
+
+	tests := []testDefs{
+		{
+			Name:       "Pass - known metrics",
+			Metrics:    []string{"builtin:service.response.time:avg", "builtin:service.response.time:percentile(90)", "builtin:service.errors.total.count"},
+			ExpectPass: true,
+		},
+		{
+			Name:          "Fail - every invalid metric is listed",
+			Metrics:       []string{"builtin:service.response.time:avg", "builtin:service.reponse.time:avg", "builtin:service.errors.total.count:avg"},
+			ExpectedError: "invalid metric selectors: builtin:service.errors.total.count:avg (metric builtin:service.errors.total.count does not support the avg aggregation. Supported aggregations are auto, value); builtin:service.reponse.time:avg (metric builtin:service.reponse.time does not exist)",
+			ExpectedCode:  datatypes.ErrorCodeInvalidMetricSelector,
+		},
+		{
+			Name:          "Fail - Dynatrace rejects the token",
+			Metrics:       []string{"builtin:forbidden"},
+			ExpectedError: "couldn't get the descriptor of builtin:forbidden from Dynatrace: invalid status code from Dynatrace: 403",
+			ExpectedCode:  datatypes.ErrorCodeAuthFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			ps := datatypes.GetValidDefaultPerformanceSignature()
+			ps.DTServer = strings.TrimPrefix(server.URL, "https://")
+			ps.PSMetrics = map[string]datatypes.PSMetric{}
+			for _, metric := range test.Metrics {
+				ps.PSMetrics[metric] = datatypes.PSMetric{}
+			}
+
+			err := validateMetricSelectors(context.Background(), ps)
+
+			if test.ExpectPass == true {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.ExpectedError)
+				assert.Equal(t, test.ExpectedCode, ValidationErrorCode(err))
+			}
+		})
+	}
+}
+
+func TestValidationErrorCode(t *testing.T) {
+	assert.Equal(t, datatypes.ErrorCodeInvalidRequest, ValidationErrorCode(fmt.Errorf("no Metrics passed with the POST")))
+	assert.Equal(t, datatypes.ErrorCodeInvalidMetricSelector, ValidationErrorCode(&MetricValidationError{Invalid: map[string]string{"a": "b"}}))
+}
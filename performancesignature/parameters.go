@@ -1,16 +1,22 @@
 package performancesignature
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/evaluations"
 	"github.com/barrebre/goDynaPerfSignature/logging"
+	"github.com/barrebre/goDynaPerfSignature/metrics"
+	"github.com/barrebre/goDynaPerfSignature/signatures"
+	"github.com/barrebre/goDynaPerfSignature/tokens"
 )
 
 // ReadAndValidateParams validates the body params sent in the request from the user
-func ReadAndValidateParams(b []byte, config datatypes.Config) (datatypes.PerformanceSignature, error) {
+func ReadAndValidateParams(ctx context.Context, b []byte, config datatypes.Config) (datatypes.PerformanceSignature, error) {
 	// Read POST body params
 	var performanceSignature datatypes.PerformanceSignature
 	err := json.Unmarshal(b, &performanceSignature)
@@ -24,37 +30,155 @@ func ReadAndValidateParams(b []byte, config datatypes.Config) (datatypes.Perform
 		return datatypes.PerformanceSignature{}, fmt.Errorf(fmt.Sprintf("checkParams - %v", err.Error()))
 	}
 
+	// Optionally make sure Dynatrace knows every metric before anything is queried
+	if updatedPerformanceSignature.ValidateMetrics {
+		err = validateMetricSelectors(ctx, updatedPerformanceSignature)
+		if err != nil {
+			return datatypes.PerformanceSignature{}, err
+		}
+	}
+
 	return updatedPerformanceSignature, nil
 }
 
+// CheckSynchronous refuses the params which only apply to asynchronous evaluations, so a synchronous request doesn't
+// expect a callback which is never sent
+func CheckSynchronous(ps datatypes.PerformanceSignature) error {
+	if ps.CallbackURL != "" || ps.CallbackSecret != "" {
+		return fmt.Errorf("a CallbackURL or CallbackSecret can only be passed to /evaluations")
+	}
+	return nil
+}
+
 // Check the required body params sent in with the request to ensure we have all the data we need to query Dt
 func checkParams(params datatypes.PerformanceSignature, config datatypes.Config) (datatypes.PerformanceSignature, error) {
-	// Build out the backend variables starting with what is in the goDynaPerfSignature config
+	tenant, err := findTenant(params.Tenant, params.APIToken, config)
+	if err != nil {
+		return datatypes.PerformanceSignature{}, err
+	}
+
+	err = checkEnvironmentOverride(tenant, params.APIToken, params.DTServer, params.DTEnv)
+	if err != nil {
+		return datatypes.PerformanceSignature{}, err
+	}
+
+	// Build out the backend variables starting with what is in the goDynaPerfSignature config or the selected tenant
 	finalQuery := datatypes.PerformanceSignature{
-		APIToken:       config.APIToken,
-		DTEnv:          config.Env,
-		DTServer:       config.Server,
-		EvaluationMins: params.EvaluationMins,
-		EventAge:       params.EventAge,
-		PSMetrics:      params.PSMetrics,
-		ServiceID:      params.ServiceID,
+		APIToken:             tenant.APIToken,
+		BaselineWindow:       params.BaselineWindow,
+		BypassCache:          params.BypassCache,
+		CallbackSecret:       params.CallbackSecret,
+		CallbackURL:          params.CallbackURL,
+		CorrelationID:        params.CorrelationID,
+		CurrentWindow:        params.CurrentWindow,
+		DTEnv:                tenant.Env,
+		DTServer:             tenant.Server,
+		EvaluationMins:       params.EvaluationMins,
+		EvaluationOffsetMins: params.EvaluationOffsetMins,
+		EventAge:             params.EventAge,
+		PSMetrics:            params.PSMetrics,
+		Quorum:               params.Quorum,
+		Resolution:           params.Resolution,
+		SeriesAggregation:    params.SeriesAggregation,
+		ServiceID:            params.ServiceID,
+		ServiceIDs:           params.ServiceIDs,
+		Signature:            params.Signature,
+		Tenant:               params.Tenant,
+		TimeoutSecs:          params.TimeoutSecs,
+		ValidateMetrics:      params.ValidateMetrics,
+		WaitForWindow:        params.WaitForWindow,
 	}
 
 	// Take the params that were sent in and apply them over the goDynaPerfSignature config
 	applyPostParams(params, &finalQuery)
 
+	if params.EventAge == 0 && config.DefaultEventAge != 0 {
+		finalQuery.EventAge = calculateAgeEpoch(config.DefaultEventAge)
+	}
+
+	// Fill in whatever the request left out from the stored signature it references
+	if finalQuery.Signature != "" {
+		signature, err := findSignature(finalQuery.Signature, params.SignatureVersion)
+		if err != nil {
+			return datatypes.PerformanceSignature{}, err
+		}
+		applySignature(signature, &finalQuery)
+	}
+
+	// Whatever neither the request nor its signature set falls back to the goDynaPerfSignature config
+	if finalQuery.EvaluationMins == 0 {
+		finalQuery.EvaluationMins = config.DefaultEvaluationMins
+	}
+
 	// Finally, ensure we have all the params we need
-	err := validateParams(finalQuery)
+	err = validateParams(finalQuery)
 	if err != nil {
 		return datatypes.PerformanceSignature{}, fmt.Errorf(fmt.Sprintf("Couldn't validate parameters: %v", err.Error()))
 	}
 
+	// Relative windows like now-30m mean the time the request was received, however long it waits or is queued
+	if hasExplicitWindows(finalQuery) {
+		finalQuery, err = pinTimeWindows(finalQuery, time.Now())
+		if err != nil {
+			return datatypes.PerformanceSignature{}, err
+		}
+	}
+
 	return finalQuery, nil
 }
 
+// findTenant returns the tenant a request selected by name, or the Dynatrace settings of the goDynaPerfSignature
+// config when it didn't select one. Its token comes from the token provider, if that has one, unless the request
+// brought its own token
+func findTenant(name string, requestToken datatypes.Secret, config datatypes.Config) (datatypes.Tenant, error) {
+	tenant := datatypes.Tenant{
+		APIToken: config.APIToken,
+		CAFile:   config.CAFile,
+		Env:      config.Env,
+		Proxy:    config.Proxy,
+		Server:   config.Server,
+	}
+
+	if name != "" {
+		var ok bool
+		tenant, ok = config.Tenants[name]
+		if !ok {
+			return datatypes.Tenant{}, fmt.Errorf("there is no tenant named %v", name)
+		}
+	}
+
+	if requestToken != "" {
+		tenant.APIToken = requestToken
+		return tenant, nil
+	}
+
+	token, err := tokens.Resolve(name, tenant.APIToken)
+	if err != nil {
+		return datatypes.Tenant{}, err
+	}
+	tenant.APIToken = token
+
+	return tenant, nil
+}
+
+// checkEnvironmentOverride refuses a DTServer or DTEnv other than the one configured with the tenant's token, unless the
+// request brought its own APIToken. Otherwise a caller could have the configured token sent to a server of their
+// choosing. Settings the config leaves out may still be passed
+func checkEnvironmentOverride(tenant datatypes.Tenant, requestToken datatypes.Secret, server string, env string) error {
+	if requestToken != "" || tenant.APIToken == "" {
+		return nil
+	}
+
+	if (server != "" && tenant.Server != "" && server != tenant.Server) || (env != "" && tenant.Env != "" && env != tenant.Env) {
+		return fmt.Errorf("a DTServer or DTEnv can only be passed with an APIToken, as the configured API token is only sent to its own environment")
+	}
+	return nil
+}
+
 func calculateAgeEpoch(days int) int {
 	logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Received eventAge for event. Checking %v days back", days)})
-	pastTime := time.Now().AddDate(0, 0, -days)
+	// Rounding to the minute lets requests made shortly after each other share cached Deployment Events
+	pastTime := time.Now().AddDate(0, 0, -days).Truncate(time.Minute)
 	return int(pastTime.Unix() * 1000)
 }
 
@@ -77,6 +201,49 @@ func applyPostParams(params datatypes.PerformanceSignature, finalQuery *datatype
 	}
 }
 
+// findSignature looks up a stored signature. A version of 0 means the current one
+func findSignature(name string, version int) (datatypes.Signature, error) {
+	if version != 0 {
+		signature, ok := signatures.DefaultRegistry().GetVersion(name, version)
+		if !ok {
+			return datatypes.Signature{}, fmt.Errorf("there is no version %v of the signature %v", version, name)
+		}
+		return signature, nil
+	}
+
+	signature, ok := signatures.DefaultRegistry().Get(name)
+	if !ok {
+		return datatypes.Signature{}, fmt.Errorf("there is no signature named %v", name)
+	}
+	return signature, nil
+}
+
+// applySignature fills in the settings of a stored signature. Metrics passed with the request replace the
+// signature's metrics of the same name, and any other request setting takes precedence over the signature's
+func applySignature(signature datatypes.Signature, finalQuery *datatypes.PerformanceSignature) {
+	psMetrics := map[string]datatypes.PSMetric{}
+	for name, metric := range signature.PSMetrics {
+		psMetrics[name] = metric
+	}
+	for name, metric := range finalQuery.PSMetrics {
+		psMetrics[name] = metric
+	}
+	finalQuery.PSMetrics = psMetrics
+	finalQuery.SignatureVersion = signature.Version
+
+	if finalQuery.EvaluationMins == 0 {
+		finalQuery.EvaluationMins = signature.EvaluationMins
+	}
+
+	if finalQuery.Resolution == "" {
+		finalQuery.Resolution = signature.Resolution
+	}
+
+	if finalQuery.SeriesAggregation == "" {
+		finalQuery.SeriesAggregation = signature.SeriesAggregation
+	}
+}
+
 // Ensure there are no missing parameters to perform a request to Dynatrace
 func validateParams(finalQuery datatypes.PerformanceSignature) error {
 	if finalQuery.APIToken == "" {
@@ -91,9 +258,60 @@ func validateParams(finalQuery datatypes.PerformanceSignature) error {
 		return fmt.Errorf("no Metrics passed with the POST")
 	}
 
-	if finalQuery.ServiceID == "" {
+	if !metrics.IsValidResolution(finalQuery.Resolution) {
+		return fmt.Errorf("the Resolution '%v' must be Inf, a number of data points, or a timespan like 1m", finalQuery.Resolution)
+	}
+
+	if !metrics.IsValidSeriesAggregation(finalQuery.SeriesAggregation) {
+		return fmt.Errorf("the SeriesAggregation '%v' must be avg, min, max, last, or a percentile like p95", finalQuery.SeriesAggregation)
+	}
+
+	if err := metrics.ValidatePSMetrics(finalQuery.PSMetrics); err != nil {
+		return err
+	}
+
+	if finalQuery.TimeoutSecs < 0 {
+		return fmt.Errorf("the TimeoutSecs cannot be negative")
+	}
+
+	if finalQuery.EvaluationOffsetMins < 0 {
+		return fmt.Errorf("the EvaluationOffsetMins cannot be negative")
+	}
+
+	if finalQuery.BaselineWindow != nil && finalQuery.CurrentWindow == nil {
+		return fmt.Errorf("a BaselineWindow was passed with the POST without a CurrentWindow")
+	}
+
+	if hasExplicitWindows(finalQuery) {
+		if _, err := resolveTimeWindows(finalQuery, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	if finalQuery.CallbackURL != "" {
+		callbackURL, err := url.Parse(finalQuery.CallbackURL)
+		if err != nil || (callbackURL.Scheme != "http" && callbackURL.Scheme != "https") || callbackURL.Host == "" {
+			return fmt.Errorf("the CallbackURL '%v' must be an absolute http or https URL", finalQuery.CallbackURL)
+		}
+		if err := evaluations.CheckCallbackURL(finalQuery.CallbackURL); err != nil {
+			return err
+		}
+	} else if finalQuery.CallbackSecret != "" {
+		return fmt.Errorf("a CallbackSecret was passed with the POST without a CallbackURL")
+	}
+
+	serviceCount := len(GetServiceIDs(finalQuery))
+	if serviceCount == 0 {
 		return fmt.Errorf("no ServiceID passed with the POST")
 	}
 
+	if finalQuery.CorrelationID != "" && (serviceCount > 1 || hasExplicitWindows(finalQuery)) {
+		return fmt.Errorf("a CorrelationID can only be passed with a single ServiceID and without a CurrentWindow")
+	}
+
+	if finalQuery.Quorum < 0 || finalQuery.Quorum > serviceCount {
+		return fmt.Errorf("the Quorum must be between 0 and the number of services (%v)", serviceCount)
+	}
+
 	return nil
 }
@@ -1,9 +1,15 @@
 package performancesignature
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/signatures"
+	"github.com/barrebre/goDynaPerfSignature/tokens"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,6 +31,24 @@ func TestReadAndValidateParams(t *testing.T) {
 	invalidJSONNoAPIToken := `{"DTServer":"testserver","DTEnv":"testEnv","PSMetrics":{"builtin:service.response.time:(avg)":{},"builtin:service.errors.total.rate:(avg)":{"StaticThreshold":1.0,"ValidationMethod":"static"}},"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
 	invalidJSONNoServer := `{"DTEnv":"testEnv","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:(avg)":{},"builtin:service.errors.total.rate:(avg)":{"StaticThreshold":1.0,"ValidationMethod":"static"}},"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
 	invalidJSONNoMetrics := `{"DTServer":"testserver","DTEnv":"testEnv","APIToken":"S2pMHW_FSlma-PPJIj3l5","ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	validJSONMultipleServices := `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:(avg)":{}},"Quorum":1,"ServiceIDs":["SERVICE-5D4E743B2BF0CCF5","SERVICE-AF7A7C5353E1E88F"]}`
+	invalidJSONQuorum := `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:(avg)":{}},"Quorum":3,"ServiceIDs":["SERVICE-5D4E743B2BF0CCF5","SERVICE-AF7A7C5353E1E88F"]}`
+	invalidJSONCorrelationID := `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:(avg)":{}},"CorrelationID":"4b3c7a0e5f0c2d1a","ServiceIDs":["SERVICE-5D4E743B2BF0CCF5","SERVICE-AF7A7C5353E1E88F"]}`
+	invalidJSONBaselineOnly := `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:(avg)":{}},"BaselineWindow":{"From":"now-1d"},"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	invalidJSONWindow := `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:(avg)":{}},"CurrentWindow":{"From":"later"},"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	validJSONUnits := `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:avg":{"StaticThreshold":"500ms","ValidationMethod":"static"},"builtin:service.errors.total.rate:avg":{"RelativeThreshold":"2%","ValidationMethod":"relative"}},"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	invalidJSONUnit := `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:avg":{"StaticThreshold":"500 parsecs","ValidationMethod":"static"}},"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	invalidJSONThreshold := `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:avg":{"StaticThreshold":"fast","ValidationMethod":"static"}},"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	invalidJSONResolution := `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:avg":{"Resolution":"1 minute"}},"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	invalidJSONSeriesAggregation := `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:avg":{}},"SeriesAggregation":"worst","ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	validJSONCallback := `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:avg":{}},"CallbackURL":"https://ci.example.com/hooks/perfsig","CallbackSecret":"s3cret","ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	invalidJSONCallbackURL := `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:avg":{}},"CallbackURL":"ci.example.com/hooks","ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	invalidJSONCallbackPrivate := `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:avg":{}},"CallbackURL":"http://169.254.169.254/latest/meta-data/","ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	invalidJSONCallbackSecret := `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:avg":{}},"CallbackSecret":"s3cret","ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	validJSONTenant := `{"Tenant":"staging","PSMetrics":{"builtin:service.response.time:avg":{}},"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	validJSONTenantOverride := `{"Tenant":"staging","DTServer":"other.live.dynatrace.com","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:avg":{}},"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	invalidJSONTenantRedirect := `{"Tenant":"staging","DTServer":"evil.example","PSMetrics":{"builtin:service.response.time:avg":{}},"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	invalidJSONTenant := `{"Tenant":"qa","PSMetrics":{"builtin:service.response.time:avg":{}},"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
 	invalidJSONNoServices := `{"DTServer":"testserver","DTEnv":"testEnv","APIToken":"S2pMHW_FSlma-PPJIj3l5","PSMetrics":{"builtin:service.response.time:(avg)":{},"builtin:service.errors.total.rate:(avg)":{"StaticThreshold":1.0,"ValidationMethod":"static"}}}`
 
 	tests := []testDefs{
@@ -42,13 +66,13 @@ func TestReadAndValidateParams(t *testing.T) {
 				EventAge:       calculateAgeEpoch(180),
 				PSMetrics: map[string]datatypes.PSMetric{
 					"builtin:service.response.time:(avg)": {
-						RelativeThreshold: 0,
-						StaticThreshold:   0,
+						RelativeThreshold: datatypes.Threshold{},
+						StaticThreshold:   datatypes.Threshold{},
 						ValidationMethod:  "",
 					},
 					"builtin:service.errors.total.rate:(avg)": {
-						RelativeThreshold: 0,
-						StaticThreshold:   1,
+						RelativeThreshold: datatypes.Threshold{},
+						StaticThreshold:   datatypes.Threshold{Value: 1},
 						ValidationMethod:  "static",
 					},
 				},
@@ -89,13 +113,13 @@ func TestReadAndValidateParams(t *testing.T) {
 				EvaluationMins: 0,
 				PSMetrics: map[string]datatypes.PSMetric{
 					"builtin:service.response.time:(avg)": {
-						RelativeThreshold: 0,
-						StaticThreshold:   0,
+						RelativeThreshold: datatypes.Threshold{},
+						StaticThreshold:   datatypes.Threshold{},
 						ValidationMethod:  "",
 					},
 					"builtin:service.errors.total.rate:(avg)": {
-						RelativeThreshold: 0,
-						StaticThreshold:   1,
+						RelativeThreshold: datatypes.Threshold{},
+						StaticThreshold:   datatypes.Threshold{Value: 1},
 						ValidationMethod:  "static",
 					},
 				},
@@ -103,6 +127,92 @@ func TestReadAndValidateParams(t *testing.T) {
 			},
 			ExpectPass: true,
 		},
+		{
+			Name: "PASS - defaults configured",
+			Values: values{
+				APIString: []byte(invalidJSONNoAPIToken),
+				Config: datatypes.Config{
+					APIToken:              "asdf",
+					DefaultEvaluationMins: 15,
+					DefaultEventAge:       30,
+				},
+			},
+			ExpectedPerfsig: datatypes.PerformanceSignature{
+				APIToken:       "asdf",
+				DTEnv:          "testEnv",
+				DTServer:       "testserver",
+				EvaluationMins: 15,
+				EventAge:       calculateAgeEpoch(30),
+				PSMetrics: map[string]datatypes.PSMetric{
+					"builtin:service.response.time:(avg)": {
+						RelativeThreshold: datatypes.Threshold{},
+						StaticThreshold:   datatypes.Threshold{},
+						ValidationMethod:  "",
+					},
+					"builtin:service.errors.total.rate:(avg)": {
+						RelativeThreshold: datatypes.Threshold{},
+						StaticThreshold:   datatypes.Threshold{Value: 1},
+						ValidationMethod:  "static",
+					},
+				},
+				ServiceID: "SERVICE-5D4E743B2BF0CCF5",
+			},
+			ExpectPass: true,
+		},
+		{
+			Name: "PASS - tenant selected",
+			Values: values{
+				APIString: []byte(validJSONTenant),
+				Config:    datatypes.GetTenantsConfig(),
+			},
+			ExpectedPerfsig: datatypes.PerformanceSignature{
+				APIToken: "stagingtoken0a9wejf09a",
+				DTEnv:    "stagingEnv",
+				DTServer: "staging.live.dynatrace.com",
+				PSMetrics: map[string]datatypes.PSMetric{
+					"builtin:service.response.time:avg": {},
+				},
+				ServiceID: "SERVICE-5D4E743B2BF0CCF5",
+				Tenant:    "staging",
+			},
+			ExpectPass: true,
+		},
+		{
+			Name: "PASS - tenant settings overridden by the POST",
+			Values: values{
+				APIString: []byte(validJSONTenantOverride),
+				Config:    datatypes.GetTenantsConfig(),
+			},
+			ExpectedPerfsig: datatypes.PerformanceSignature{
+				APIToken: "S2pMHW_FSlma-PPJIj3l5",
+				DTEnv:    "stagingEnv",
+				DTServer: "other.live.dynatrace.com",
+				PSMetrics: map[string]datatypes.PSMetric{
+					"builtin:service.response.time:avg": {},
+				},
+				ServiceID: "SERVICE-5D4E743B2BF0CCF5",
+				Tenant:    "staging",
+			},
+			ExpectPass: true,
+		},
+		{
+			Name: "Fail - tenant token sent to another server",
+			Values: values{
+				APIString: []byte(invalidJSONTenantRedirect),
+				Config:    datatypes.GetTenantsConfig(),
+			},
+			ExpectPass:    false,
+			ExpectedError: "checkParams - a DTServer or DTEnv can only be passed with an APIToken, as the configured API token is only sent to its own environment",
+		},
+		{
+			Name: "Fail - unknown tenant",
+			Values: values{
+				APIString: []byte(invalidJSONTenant),
+				Config:    datatypes.GetTenantsConfig(),
+			},
+			ExpectPass:    false,
+			ExpectedError: "checkParams - there is no tenant named qa",
+		},
 		{
 			Name: "Fail - no metrics provided",
 			Values: values{
@@ -121,6 +231,163 @@ func TestReadAndValidateParams(t *testing.T) {
 			ExpectPass:    false,
 			ExpectedError: "checkParams - Couldn't validate parameters: no ServiceID passed with the POST",
 		},
+		{
+			Name: "Pass - multiple services",
+			Values: values{
+				APIString: []byte(validJSONMultipleServices),
+				Config:    datatypes.Config{},
+			},
+			ExpectedPerfsig: datatypes.PerformanceSignature{
+				APIToken: "S2pMHW_FSlma-PPJIj3l5",
+				DTServer: "testserver",
+				PSMetrics: map[string]datatypes.PSMetric{
+					"builtin:service.response.time:(avg)": {},
+				},
+				Quorum:     1,
+				ServiceIDs: []string{"SERVICE-5D4E743B2BF0CCF5", "SERVICE-AF7A7C5353E1E88F"},
+			},
+			ExpectPass: true,
+		},
+		{
+			Name: "Fail - quorum larger than the number of services",
+			Values: values{
+				APIString: []byte(invalidJSONQuorum),
+				Config:    datatypes.Config{},
+			},
+			ExpectPass:    false,
+			ExpectedError: "checkParams - Couldn't validate parameters: the Quorum must be between 0 and the number of services (2)",
+		},
+		{
+			Name: "Fail - correlation ID with multiple services",
+			Values: values{
+				APIString: []byte(invalidJSONCorrelationID),
+				Config:    datatypes.Config{},
+			},
+			ExpectPass:    false,
+			ExpectedError: "checkParams - Couldn't validate parameters: a CorrelationID can only be passed with a single ServiceID and without a CurrentWindow",
+		},
+		{
+			Name: "Fail - baseline window without a current window",
+			Values: values{
+				APIString: []byte(invalidJSONBaselineOnly),
+				Config:    datatypes.Config{},
+			},
+			ExpectPass:    false,
+			ExpectedError: "checkParams - Couldn't validate parameters: a BaselineWindow was passed with the POST without a CurrentWindow",
+		},
+		{
+			Name: "Fail - invalid current window",
+			Values: values{
+				APIString: []byte(invalidJSONWindow),
+				Config:    datatypes.Config{},
+			},
+			ExpectPass:    false,
+			ExpectedError: "checkParams - Couldn't validate parameters: invalid CurrentWindow: could not parse From: 'later' is not epoch milliseconds, an RFC3339 timestamp, or a relative time like now-30m",
+		},
+		{
+			Name: "Pass - thresholds with units",
+			Values: values{
+				APIString: []byte(validJSONUnits),
+				Config:    datatypes.Config{},
+			},
+			ExpectedPerfsig: datatypes.PerformanceSignature{
+				APIToken: "S2pMHW_FSlma-PPJIj3l5",
+				DTServer: "testserver",
+				PSMetrics: map[string]datatypes.PSMetric{
+					"builtin:service.response.time:avg": {
+						StaticThreshold:  datatypes.Threshold{Value: 500, Unit: "ms"},
+						ValidationMethod: "static",
+					},
+					"builtin:service.errors.total.rate:avg": {
+						RelativeThreshold: datatypes.Threshold{Value: 2, Unit: "%"},
+						ValidationMethod:  "relative",
+					},
+				},
+				ServiceID: "SERVICE-5D4E743B2BF0CCF5",
+			},
+			ExpectPass: true,
+		},
+		{
+			Name: "Fail - threshold with an unknown unit",
+			Values: values{
+				APIString: []byte(invalidJSONUnit),
+				Config:    datatypes.Config{},
+			},
+			ExpectPass:    false,
+			ExpectedError: "checkParams - Couldn't validate parameters: the StaticThreshold of builtin:service.response.time:avg has an unknown unit 'parsecs'",
+		},
+		{
+			Name: "Fail - threshold without a number",
+			Values: values{
+				APIString: []byte(invalidJSONThreshold),
+				Config:    datatypes.Config{},
+			},
+			ExpectPass:    false,
+			ExpectedError: "could not read the threshold 'fast': it must start with a number",
+		},
+		{
+			Name: "Fail - invalid metric resolution",
+			Values: values{
+				APIString: []byte(invalidJSONResolution),
+				Config:    datatypes.Config{},
+			},
+			ExpectPass:    false,
+			ExpectedError: "checkParams - Couldn't validate parameters: the Resolution '1 minute' of builtin:service.response.time:avg must be Inf, a number of data points, or a timespan like 1m",
+		},
+		{
+			Name: "Fail - invalid series aggregation",
+			Values: values{
+				APIString: []byte(invalidJSONSeriesAggregation),
+				Config:    datatypes.Config{},
+			},
+			ExpectPass:    false,
+			ExpectedError: "checkParams - Couldn't validate parameters: the SeriesAggregation 'worst' must be avg, min, max, last, or a percentile like p95",
+		},
+		{
+			Name: "Pass - callback",
+			Values: values{
+				APIString: []byte(validJSONCallback),
+				Config:    datatypes.Config{},
+			},
+			ExpectedPerfsig: datatypes.PerformanceSignature{
+				APIToken:       "S2pMHW_FSlma-PPJIj3l5",
+				CallbackSecret: "s3cret",
+				CallbackURL:    "https://ci.example.com/hooks/perfsig",
+				DTServer:       "testserver",
+				PSMetrics: map[string]datatypes.PSMetric{
+					"builtin:service.response.time:avg": {},
+				},
+				ServiceID: "SERVICE-5D4E743B2BF0CCF5",
+			},
+			ExpectPass: true,
+		},
+		{
+			Name: "Fail - relative callback URL",
+			Values: values{
+				APIString: []byte(invalidJSONCallbackURL),
+				Config:    datatypes.Config{},
+			},
+			ExpectPass:    false,
+			ExpectedError: "checkParams - Couldn't validate parameters: the CallbackURL 'ci.example.com/hooks' must be an absolute http or https URL",
+		},
+		{
+			Name: "Fail - callback to a private address",
+			Values: values{
+				APIString: []byte(invalidJSONCallbackPrivate),
+				Config:    datatypes.Config{},
+			},
+			ExpectPass:    false,
+			ExpectedError: "checkParams - Couldn't validate parameters: callbacks can't be sent to loopback, link-local or private addresses",
+		},
+		{
+			Name: "Fail - callback secret without a callback URL",
+			Values: values{
+				APIString: []byte(invalidJSONCallbackSecret),
+				Config:    datatypes.Config{},
+			},
+			ExpectPass:    false,
+			ExpectedError: "checkParams - Couldn't validate parameters: a CallbackSecret was passed with the POST without a CallbackURL",
+		},
 		{
 			Name: "Fail - invalid JSON",
 			Values: values{
@@ -133,7 +400,7 @@ func TestReadAndValidateParams(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.Name, func(t *testing.T) {
-			perfsig, err := ReadAndValidateParams(test.Values.APIString, test.Values.Config)
+			perfsig, err := ReadAndValidateParams(context.Background(), test.Values.APIString, test.Values.Config)
 
 			if test.ExpectPass == true {
 				assert.NoError(t, err)
@@ -144,3 +411,203 @@ func TestReadAndValidateParams(t *testing.T) {
 		})
 	}
 }
+
+func TestReadAndValidateParamsWithSignature(t *testing.T) {
+	type testDefs struct {
+		Name            string
+		APIString       string
+		ExpectedPerfsig datatypes.PerformanceSignature
+		ExpectPass      bool
+		ExpectedError   string
+	}
+
+	dir, err := ioutil.TempDir("", "signatures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	signatureJSON := `{"EvaluationMins":10,"PSMetrics":{"builtin:service.response.time:avg":{"StaticThreshold":"500ms","ValidationMethod":"static"},"builtin:service.errors.total.rate:avg":{"RelativeThreshold":1,"ValidationMethod":"relative"}},"SeriesAggregation":"p90"}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "checkout-api.json"), []byte(signatureJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := signatures.LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousRegistry := signatures.DefaultRegistry()
+	signatures.SetDefaultRegistry(registry)
+	defer signatures.SetDefaultRegistry(previousRegistry)
+
+	// Version 2 only checks the response time, so pinning version 1 is noticeable
+	_, err = registry.Put(datatypes.Signature{
+		Name: "checkout-api",
+		PSMetrics: map[string]datatypes.PSMetric{
+			"builtin:service.response.time:avg": {StaticThreshold: datatypes.Threshold{Value: 1, Unit: "s"}, ValidationMethod: "static"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []testDefs{
+		{
+			Name:      "Pass - the signature's metrics and settings",
+			APIString: `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","Signature":"checkout-api","SignatureVersion":1,"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`,
+			ExpectedPerfsig: datatypes.PerformanceSignature{
+				APIToken:       "S2pMHW_FSlma-PPJIj3l5",
+				DTServer:       "testserver",
+				EvaluationMins: 10,
+				PSMetrics: map[string]datatypes.PSMetric{
+					"builtin:service.response.time:avg": {
+						StaticThreshold:  datatypes.Threshold{Value: 500, Unit: "ms"},
+						ValidationMethod: "static",
+					},
+					"builtin:service.errors.total.rate:avg": {
+						RelativeThreshold: datatypes.Threshold{Value: 1},
+						ValidationMethod:  "relative",
+					},
+				},
+				SeriesAggregation: "p90",
+				ServiceID:         "SERVICE-5D4E743B2BF0CCF5",
+				Signature:         "checkout-api",
+				SignatureVersion:  1,
+			},
+			ExpectPass: true,
+		},
+		{
+			Name:      "Pass - request fields override the signature",
+			APIString: `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","Signature":"checkout-api","SignatureVersion":1,"EvaluationMins":5,"SeriesAggregation":"max","PSMetrics":{"builtin:service.response.time:avg":{"StaticThreshold":"800ms","ValidationMethod":"static"},"builtin:service.cpu.time:avg":{"RelativeThreshold":"10%","ValidationMethod":"relative"}},"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`,
+			ExpectedPerfsig: datatypes.PerformanceSignature{
+				APIToken:       "S2pMHW_FSlma-PPJIj3l5",
+				DTServer:       "testserver",
+				EvaluationMins: 5,
+				PSMetrics: map[string]datatypes.PSMetric{
+					"builtin:service.response.time:avg": {
+						StaticThreshold:  datatypes.Threshold{Value: 800, Unit: "ms"},
+						ValidationMethod: "static",
+					},
+					"builtin:service.errors.total.rate:avg": {
+						RelativeThreshold: datatypes.Threshold{Value: 1},
+						ValidationMethod:  "relative",
+					},
+					"builtin:service.cpu.time:avg": {
+						RelativeThreshold: datatypes.Threshold{Value: 10, Unit: "%"},
+						ValidationMethod:  "relative",
+					},
+				},
+				SeriesAggregation: "max",
+				ServiceID:         "SERVICE-5D4E743B2BF0CCF5",
+				Signature:         "checkout-api",
+				SignatureVersion:  1,
+			},
+			ExpectPass: true,
+		},
+		{
+			Name:      "Pass - the current version",
+			APIString: `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","Signature":"checkout-api","ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`,
+			ExpectedPerfsig: datatypes.PerformanceSignature{
+				APIToken: "S2pMHW_FSlma-PPJIj3l5",
+				DTServer: "testserver",
+				PSMetrics: map[string]datatypes.PSMetric{
+					"builtin:service.response.time:avg": {
+						StaticThreshold:  datatypes.Threshold{Value: 1, Unit: "s"},
+						ValidationMethod: "static",
+					},
+				},
+				ServiceID:        "SERVICE-5D4E743B2BF0CCF5",
+				Signature:        "checkout-api",
+				SignatureVersion: 2,
+			},
+			ExpectPass: true,
+		},
+		{
+			Name:          "Fail - unknown signature version",
+			APIString:     `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","Signature":"checkout-api","SignatureVersion":3,"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`,
+			ExpectPass:    false,
+			ExpectedError: "checkParams - there is no version 3 of the signature checkout-api",
+		},
+		{
+			Name:          "Fail - unknown signature",
+			APIString:     `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","Signature":"search","ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`,
+			ExpectPass:    false,
+			ExpectedError: "checkParams - there is no signature named search",
+		},
+		{
+			Name:          "Fail - invalid override",
+			APIString:     `{"DTServer":"testserver","APIToken":"S2pMHW_FSlma-PPJIj3l5","Signature":"checkout-api","PSMetrics":{"builtin:service.response.time:avg":{"StaticThreshold":"500 parsecs"}},"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`,
+			ExpectPass:    false,
+			ExpectedError: "checkParams - Couldn't validate parameters: the StaticThreshold of builtin:service.response.time:avg has an unknown unit 'parsecs'",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			perfsig, err := ReadAndValidateParams(context.Background(), []byte(test.APIString), datatypes.Config{})
+
+			if test.ExpectPass {
+				assert.NoError(t, err)
+				assert.Equal(t, test.ExpectedPerfsig, perfsig)
+			} else {
+				assert.EqualError(t, err, test.ExpectedError)
+			}
+		})
+	}
+}
+
+func TestFindTenantTokenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "staging")
+	if err := ioutil.WriteFile(tokenFile, []byte("stagingtokenfromfile\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	previousProvider := tokens.DefaultProvider()
+	tokens.SetDefaultProvider(tokens.NewFileProvider(map[string]string{
+		"staging": tokenFile,
+		"qa":      filepath.Join(dir, "missing"),
+	}))
+	defer tokens.SetDefaultProvider(previousProvider)
+
+	config := datatypes.GetTenantsConfig()
+	config.Tenants = map[string]datatypes.Tenant{
+		"staging": {APITokenFile: tokenFile, Server: "staging.live.dynatrace.com"},
+		"qa":      {Server: "qa.live.dynatrace.com"},
+	}
+
+	tenant, err := findTenant("staging", "", config)
+	assert.NoError(t, err)
+	assert.Equal(t, "stagingtokenfromfile", tenant.APIToken.Reveal())
+
+	// The default environment has no file, so keeps the token from the config
+	tenant, err = findTenant("", "", config)
+	assert.NoError(t, err)
+	assert.Equal(t, config.APIToken, tenant.APIToken)
+
+	_, err = findTenant("qa", "", config)
+	assert.Error(t, err)
+
+	// A request with its own token doesn't need the token file
+	tenant, err = findTenant("qa", "S2pMHW_FSlma-PPJIj3l5", config)
+	assert.NoError(t, err)
+	assert.Equal(t, datatypes.Secret("S2pMHW_FSlma-PPJIj3l5"), tenant.APIToken)
+	assert.Equal(t, "qa.live.dynatrace.com", tenant.Server)
+}
+
+func TestCheckSynchronous(t *testing.T) {
+	ps := datatypes.GetValidDefaultPerformanceSignature()
+	assert.NoError(t, CheckSynchronous(ps))
+
+	ps.CallbackURL = "https://ci.example.com/hooks/perfsig"
+	assert.EqualError(t, CheckSynchronous(ps), "a CallbackURL or CallbackSecret can only be passed to /evaluations")
+
+	ps.CallbackURL = ""
+	ps.CallbackSecret = "s3cret"
+	assert.EqualError(t, CheckSynchronous(ps), "a CallbackURL or CallbackSecret can only be passed to /evaluations")
+}
@@ -1,44 +1,213 @@
 package performancesignature
 
 import (
+	"context"
 	"fmt"
-	"net/http"
+	"math"
 	"strings"
+	"time"
 
 	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/dynatrace"
 	"github.com/barrebre/goDynaPerfSignature/logging"
 	"github.com/barrebre/goDynaPerfSignature/metrics"
 )
 
-// ProcessRequest handles requests we receive to /performanceSignature
-func ProcessRequest(w http.ResponseWriter, r *http.Request, ps datatypes.PerformanceSignature) datatypes.PerformanceSignatureReturn {
-	// Build the HTTP request object with query for deployments
-	req, err := buildDeploymentRequest(ps)
-	if err != nil {
-		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Error building deployment request: %v.", err)})
-		return datatypes.PerformanceSignatureReturn{
-			Error:    true,
-			Response: []string{"Internal error building deployment request"},
+// ProcessRequest handles requests we receive to /performanceSignature. Cancelling ctx, or reaching the TimeoutSecs of the
+// request, cancels any queries to Dynatrace which are still in flight
+func ProcessRequest(ctx context.Context, ps datatypes.PerformanceSignature) datatypes.PerformanceSignatureReturn {
+	if ps.TimeoutSecs > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(ps.TimeoutSecs)*time.Second)
+		defer cancel()
+	}
+
+	if ps.BypassCache {
+		ctx = dynatrace.WithCacheBypass(ctx)
+	}
+
+	ctx, retryStats := dynatrace.WithRetryStats(ctx)
+	response := evaluateServices(ctx, ps)
+
+	if retryStats.Retries() > 0 {
+		response.Retries = retryStats.Retries()
+		response.RetryWaitMs = int64(retryStats.Wait() / time.Millisecond)
+		logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Retried requests to Dynatrace %v times, waiting %v in total", retryStats.Retries(), retryStats.Wait())})
+	}
+
+	return response
+}
+
+// evaluateServices evaluates every requested service and combines their results
+func evaluateServices(ctx context.Context, ps datatypes.PerformanceSignature) datatypes.PerformanceSignatureReturn {
+	serviceIDs := GetServiceIDs(ps)
+
+	// A single service keeps the original response shape
+	if len(serviceIDs) == 1 {
+		ps.ServiceID = serviceIDs[0]
+		return processService(ctx, ps)
+	}
+
+	var results []datatypes.ServiceResult
+	for _, serviceID := range serviceIDs {
+		servicePS := ps
+		servicePS.ServiceID = serviceID
+
+		logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Evaluating service %v", serviceID)})
+		serviceResponse := processService(ctx, servicePS)
+		results = append(results, datatypes.ServiceResult{
+			ServiceID:      serviceID,
+			Error:          serviceResponse.Error,
+			ErrorCode:      serviceResponse.ErrorCode,
+			Pass:           serviceResponse.Pass,
+			Pending:        serviceResponse.Pending,
+			RetryAfterSecs: serviceResponse.RetryAfterSecs,
+			Response:       serviceResponse.Response,
+		})
+	}
+
+	response := aggregateServiceResults(results, ps.Quorum)
+	logging.LogInfo(datatypes.Logging{Message: strings.Join(response.Response, "; ")})
+	return response
+}
+
+// GetServiceIDs returns every service requested, in the order given and without duplicates
+func GetServiceIDs(ps datatypes.PerformanceSignature) []string {
+	var serviceIDs []string
+	seen := map[string]bool{}
+
+	for _, serviceID := range append([]string{ps.ServiceID}, ps.ServiceIDs...) {
+		if serviceID == "" || seen[serviceID] {
+			continue
 		}
+		seen[serviceID] = true
+		serviceIDs = append(serviceIDs, serviceID)
 	}
 
-	// Query Dt for events on the given service
-	deploymentEvents, err := getDeploymentEvents(*req)
-	if err != nil {
-		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Encountered error gathering event timestamps: %v.", err)})
-		return datatypes.PerformanceSignatureReturn{
-			Error:    true,
-			Response: []string{"Encountered error gathering event timestamps from Dynatrace"},
+	return serviceIDs
+}
+
+// aggregateServiceResults combines the per-service results into one verdict. The signature passes if at least
+// quorum services passed. A quorum of 0 requires every service to pass
+func aggregateServiceResults(results []datatypes.ServiceResult, quorum int) datatypes.PerformanceSignatureReturn {
+	if quorum < 1 || quorum > len(results) {
+		quorum = len(results)
+	}
+
+	passed := 0
+	errored := 0
+	pending := 0
+	retryAfterSecs := 0
+	errorCode := ""
+	for _, result := range results {
+		if result.Error {
+			errored++
+			if errorCode == "" {
+				errorCode = result.ErrorCode
+			}
+		} else if result.Pending {
+			pending++
+			if result.RetryAfterSecs > retryAfterSecs {
+				retryAfterSecs = result.RetryAfterSecs
+			}
+		} else if result.Pass {
+			passed++
 		}
 	}
 
-	// Parse those events to determine when the timestamps we should inspect are
-	timestamps, err := parseDeploymentTimestamps(deploymentEvents, ps.EvaluationMins)
-	if err != nil {
-		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Error parsing deployment timestamps: %v.", err)})
-		return datatypes.PerformanceSignatureReturn{
-			Error:    true,
-			Response: []string{"Error parsing deployment timestamps"},
+	response := datatypes.PerformanceSignatureReturn{
+		Pass:           passed >= quorum,
+		ServiceResults: results,
+	}
+
+	// Pending services only matter if they could still bring the signature to its quorum
+	if !response.Pass && pending > 0 && passed+pending >= quorum {
+		response.Pending = true
+		response.RetryAfterSecs = retryAfterSecs
+	}
+
+	// Errors only matter to the caller if they kept the quorum from being reached
+	response.Error = !response.Pass && !response.Pending && errored > 0
+	if response.Error {
+		response.ErrorCode = errorCode
+	}
+
+	verdict := "PASS"
+	if response.Pending {
+		verdict = "PENDING"
+	} else if !response.Pass {
+		verdict = "FAIL"
+	}
+	response.Response = []string{fmt.Sprintf("%v - %v of %v services passed (quorum %v)", verdict, passed, len(results), quorum)}
+	if pending > 0 {
+		response.Response = append(response.Response, fmt.Sprintf("%v services have evaluation windows which have not finished", pending))
+	}
+	if errored > 0 {
+		response.Response = append(response.Response, fmt.Sprintf("%v services could not be evaluated", errored))
+	}
+
+	return response
+}
+
+// processService runs the performance signature against the single service in ps.ServiceID
+func processService(ctx context.Context, ps datatypes.PerformanceSignature) datatypes.PerformanceSignatureReturn {
+	var timestamps []datatypes.Timestamps
+	if hasExplicitWindows(ps) {
+		// Explicit windows bypass Deployment Events entirely
+		var err error
+		timestamps, err = resolveTimeWindows(ps, time.Now())
+		if err == nil {
+			err = validateEvaluationWindows(timestamps, time.Now())
+		}
+		if incomplete, ok := err.(*incompleteWindowError); ok {
+			return handleIncompleteWindow(ctx, ps, incomplete)
+		}
+		if err != nil {
+			logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Error resolving time windows: %v.", err)})
+			return datatypes.PerformanceSignatureReturn{
+				Error:     true,
+				ErrorCode: datatypes.ErrorCodeInvalidRequest,
+				Response:  []string{fmt.Sprintf("Error resolving the provided time windows: %v", err)},
+			}
+		}
+	} else {
+		// Query Dt for events on the given service
+		deploymentEvents, err := dynatrace.DefaultClient().GetDeploymentEvents(ctx, dynatrace.EnvironmentFor(ps), ps.ServiceID, ps.EventAge)
+		if ctx.Err() != nil {
+			return cancelledResponse(ctx)
+		}
+		if err != nil {
+			logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Encountered error gathering event timestamps: %v.", err)})
+			return datatypes.PerformanceSignatureReturn{
+				Error:     true,
+				ErrorCode: dynatrace.ErrorCode(err),
+				Response:  []string{fmt.Sprintf("Encountered error gathering event timestamps from Dynatrace: %v", err)},
+			}
+		}
+
+		// Start from the deployment the request asked for, if it named one
+		deploymentEvents, err = selectDeploymentEvents(deploymentEvents, ps.CorrelationID)
+		if err != nil {
+			logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Error selecting the deployment event: %v.", err)})
+			return datatypes.PerformanceSignatureReturn{
+				Error:     true,
+				ErrorCode: datatypes.ErrorCodeNotFound,
+				Response:  []string{fmt.Sprintf("Error selecting the deployment event: %v", err)},
+			}
+		}
+
+		// Parse those events to determine when the timestamps we should inspect are
+		timestamps, err = parseDeploymentTimestamps(deploymentEvents, ps.EvaluationMins, ps.EvaluationOffsetMins)
+		if incomplete, ok := err.(*incompleteWindowError); ok {
+			return handleIncompleteWindow(ctx, ps, incomplete)
+		}
+		if err != nil {
+			logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Error parsing deployment timestamps: %v.", err)})
+			return datatypes.PerformanceSignatureReturn{
+				Error:     true,
+				ErrorCode: datatypes.ErrorCodeInvalidRequest,
+				Response:  []string{fmt.Sprintf("Error parsing deployment timestamps: %v", err)},
+			}
 		}
 	}
 
@@ -51,58 +220,99 @@ func ProcessRequest(w http.ResponseWriter, r *http.Request, ps datatypes.Perform
 	}
 
 	// Get the requested metrics for the discovered timestamp(s)
-	metricsResponse, err := metrics.GetMetrics(ps, timestamps)
+	metricsResponse, err := metrics.GetMetrics(ctx, ps, timestamps)
+	if ctx.Err() != nil {
+		return cancelledResponse(ctx)
+	}
 	if err != nil {
 		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Encountered error gathering metrics: %v.", err)})
 		return datatypes.PerformanceSignatureReturn{
-			Error:    true,
-			Response: []string{"Encountered error gathering metrics"},
+			Error:     true,
+			ErrorCode: dynatrace.ErrorCode(err),
+			Response:  []string{fmt.Sprintf("Encountered error gathering metrics: %v", err)},
 		}
 	}
 	logging.LogDebug(datatypes.Logging{Message: fmt.Sprintf("Found metrics:\n%v\n", metricsResponse)})
+	recordServiceEvaluation(ctx, datatypes.ServiceEvaluation{ServiceID: ps.ServiceID, Windows: timestamps, Metrics: metricsResponse})
 
 	// Ensure the gathered metrics are within the expected perfSignature
 	response := checkPerfSignature(ps, metricsResponse)
 	if response.Error {
-		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Error occurred when checking performance signature: %v.", response.Error)})
-		return datatypes.PerformanceSignatureReturn{
-			Error:    true,
-			Response: []string{fmt.Sprintf("Error occurred when checking performance signature: %v", err)},
+		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Error occurred when checking performance signature: %v.", response.Response)})
+		if response.ErrorCode == "" {
+			response.ErrorCode = datatypes.ErrorCodeInternal
 		}
+		return response
 	}
 
 	logging.LogInfo(datatypes.Logging{Message: strings.Join(response.Response, "; ")})
 	return response
 }
 
-// Builds the request for getting Deployments from Dynatrace
-func buildDeploymentRequest(ps datatypes.PerformanceSignature) (*http.Request, error) {
-	// Build the URL
-	var url string
+type waitLimitKey struct{}
 
-	if ps.DTEnv == "" {
-		url = fmt.Sprintf("https://%v/api/v1/events?eventType=CUSTOM_DEPLOYMENT&entityId=%v", ps.DTServer, ps.ServiceID)
-	} else {
-		url = fmt.Sprintf("https://%v/e/%v/api/v1/events?eventType=CUSTOM_DEPLOYMENT&entityId=%v", ps.DTServer, ps.DTEnv, ps.ServiceID)
+// WithWaitLimit returns a context whose evaluations only wait for their window with WaitForWindow if it closes within
+// limit. Without one, as for queued evaluations which are rescheduled instead, they are reported as pending right away
+func WithWaitLimit(ctx context.Context, limit time.Duration) context.Context {
+	return context.WithValue(ctx, waitLimitKey{}, limit)
+}
+
+// waitLimit returns how long an evaluation with ctx may wait for its window
+func waitLimit(ctx context.Context) time.Duration {
+	limit, _ := ctx.Value(waitLimitKey{}).(time.Duration)
+	return limit
+}
+
+// handleIncompleteWindow either reports that the evaluation is pending or, if the requester asked to wait and the
+// window closes soon enough, waits for it to close and then evaluates the service
+func handleIncompleteWindow(ctx context.Context, ps datatypes.PerformanceSignature, incomplete *incompleteWindowError) datatypes.PerformanceSignatureReturn {
+	wait := time.Until(incomplete.ReadyAt)
+
+	if ps.WaitForWindow && wait > waitLimit(ctx) {
+		logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Not waiting %v for the evaluation window of %v, as it is longer than the %v allowed.", wait, ps.ServiceID, waitLimit(ctx))})
 	}
 
-	if ps.EventAge != 0 {
-		url += fmt.Sprintf("&from=%v", ps.EventAge)
-		logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Found EventAge with request - new URL is %v", url)})
+	if !ps.WaitForWindow || wait > waitLimit(ctx) {
+		retryAfterSecs := int(math.Ceil(wait.Seconds()))
+		logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Evaluation of %v is pending: %v.", ps.ServiceID, incomplete)})
+		return datatypes.PerformanceSignatureReturn{
+			Pending:        true,
+			RetryAfterSecs: retryAfterSecs,
+			Response:       []string{fmt.Sprintf("PENDING - %v. Retry in %v seconds", incomplete, retryAfterSecs)},
+		}
 	}
 
-	// Build the request object
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Error creating request handler: %v", err)})
-		return &http.Request{}, err
+	logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Waiting %v for the evaluation window of %v to finish", wait, ps.ServiceID)})
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Stopped waiting for the evaluation window of %v: %v.", ps.ServiceID, ctx.Err())})
+		return cancelledResponse(ctx)
 	}
 
-	// Add the API token
-	apiTokenField := fmt.Sprintf("Api-Token %v", ps.APIToken)
-	req.Header.Add("Authorization", apiTokenField)
+	// Only wait once. If the window still isn't finished, report it as pending
+	ps.WaitForWindow = false
+	return processService(ctx, ps)
+}
+
+// cancelledResponse explains why an evaluation stopped before it could finish
+func cancelledResponse(ctx context.Context) datatypes.PerformanceSignatureReturn {
+	reason := "the request was cancelled"
+	errorCode := datatypes.ErrorCodeCancelled
+	if ctx.Err() == context.DeadlineExceeded {
+		reason = "the evaluation timed out"
+		errorCode = datatypes.ErrorCodeTimeout
+	}
 
-	return req, nil
+	logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Evaluation stopped: %v.", reason)})
+	return datatypes.PerformanceSignatureReturn{
+		Error:     true,
+		ErrorCode: errorCode,
+		Response:  []string{fmt.Sprintf("Evaluation stopped before it finished because %v", reason)},
+	}
 }
 
 // For each metric, perform its checks
@@ -118,7 +328,7 @@ func checkPerfSignature(performanceSignature datatypes.PerformanceSignature, met
 	}
 
 	var cleanMetricName string
-	for num, metric := range metricsResponse.CurrentMetrics.Metrics {
+	for _, metric := range metricsResponse.CurrentMetrics.Metrics {
 		if strings.Contains(metric.MetricId, "percentile") {
 			cleanMetricName = metric.MetricId
 		} else {
@@ -141,25 +351,30 @@ func checkPerfSignature(performanceSignature datatypes.PerformanceSignature, met
 				Response: []string{fmt.Sprintf("PASS - There were no current metric values returned from Dynatrace for %v", cleanMetricName)},
 			}
 		}
-		currentMetricValues := metric.MetricValues[0].Values[0]
 
-		// This is only an issue if trying a comparison
-		canCompare := true
-		var previousMetricValues float64
-		if len(metricsResponse.PreviousMetrics.Metrics[num].MetricValues) < 1 {
-			canCompare = false
-		} else {
-			if len(metricsResponse.PreviousMetrics.Metrics[num].MetricValues[0].Values) < 1 {
-				canCompare = false
-			} else {
-				previousMetricValues = metricsResponse.PreviousMetrics.Metrics[num].MetricValues[0].Values[0]
+		seriesAggregation := metrics.MetricSeriesAggregation(performanceSignature, localSig)
+		currentMetricValues, err := metrics.CollapseValues(metric.MetricValues[0].Values, seriesAggregation)
+		if err != nil {
+			return datatypes.PerformanceSignatureReturn{
+				Error:     true,
+				ErrorCode: datatypes.ErrorCodeInvalidRequest,
+				Response:  []string{fmt.Sprintf("Couldn't aggregate the values of %v: %v", cleanMetricName, err)},
 			}
 		}
 
+		// This is only an issue if trying a comparison
+		previousMetricValues, canCompare := findPreviousMetricValue(metricsResponse.PreviousMetrics, metric.MetricId, seriesAggregation)
+
+		unit := findMetricUnit(metricsResponse.Units, cleanMetricName, metric.MetricId)
+
 		switch checkCounts := localSig.ValidationMethod; checkCounts {
 		case "relative":
 			logging.LogDebug(datatypes.Logging{Message: "Relative Check"})
-			response, err := metrics.CheckRelativeThreshold(currentMetricValues, previousMetricValues, localSig.RelativeThreshold, cleanMetricName)
+			relativeThreshold, err := convertRelativeThreshold(localSig.RelativeThreshold, previousMetricValues, unit)
+			if err != nil {
+				return thresholdErrorResponse(cleanMetricName, err)
+			}
+			response, err := metrics.CheckRelativeThreshold(currentMetricValues, previousMetricValues, relativeThreshold, unit, cleanMetricName)
 			if err != nil {
 				degradationText := fmt.Sprintf("Metric degradation found: %v", err)
 				logging.LogInfo(datatypes.Logging{Message: degradationText})
@@ -170,7 +385,11 @@ func checkPerfSignature(performanceSignature datatypes.PerformanceSignature, met
 			}
 		case "static":
 			logging.LogDebug(datatypes.Logging{Message: "Static Check"})
-			response, err := metrics.CheckStaticThreshold(currentMetricValues, localSig.StaticThreshold, cleanMetricName)
+			staticThreshold, err := metrics.ConvertThreshold(localSig.StaticThreshold, unit)
+			if err != nil {
+				return thresholdErrorResponse(cleanMetricName, err)
+			}
+			response, err := metrics.CheckStaticThreshold(currentMetricValues, staticThreshold, unit, cleanMetricName)
 			if err != nil {
 				degradationText := fmt.Sprintf("Metric degradation found: %v", err)
 				logging.LogInfo(datatypes.Logging{Message: degradationText})
@@ -185,7 +404,7 @@ func checkPerfSignature(performanceSignature datatypes.PerformanceSignature, met
 				degradationText := fmt.Sprintf("No previous metrics to compare against for metric %v", cleanMetricName)
 				result.Response = append(result.Response, degradationText)
 			} else {
-				response, err := metrics.CompareMetrics(currentMetricValues, previousMetricValues, cleanMetricName)
+				response, err := metrics.CompareMetrics(currentMetricValues, previousMetricValues, unit, cleanMetricName)
 				if err != nil {
 					degradationText := fmt.Sprintf("Metric degradation found: %v", err)
 					logging.LogInfo(datatypes.Logging{Message: degradationText})
@@ -199,3 +418,50 @@ func checkPerfSignature(performanceSignature datatypes.PerformanceSignature, met
 	}
 	return result
 }
+
+// findPreviousMetricValue looks up the previous value of a metric by its ID, so the current and previous responses
+// do not need to list their metrics in the same order
+func findPreviousMetricValue(previous datatypes.DynatraceMetricsResponse, metricID string, seriesAggregation string) (float64, bool) {
+	for _, metric := range previous.Metrics {
+		if metric.MetricId != metricID {
+			continue
+		}
+
+		if len(metric.MetricValues) < 1 {
+			return 0, false
+		}
+		value, err := metrics.CollapseValues(metric.MetricValues[0].Values, seriesAggregation)
+		return value, err == nil
+	}
+
+	return 0, false
+}
+
+// findMetricUnit looks up the unit of a metric by the name it was requested with
+func findMetricUnit(units map[string]string, names ...string) string {
+	for _, name := range names {
+		if unit, ok := units[name]; ok {
+			return unit
+		}
+	}
+	return ""
+}
+
+// convertRelativeThreshold converts a relative threshold into the unit of the metric. A percentage is taken as a
+// share of the previous value, so "5%" allows the metric to get 5% worse
+func convertRelativeThreshold(threshold datatypes.Threshold, previous float64, unit string) (float64, error) {
+	if threshold.Unit == "%" {
+		return math.Abs(previous) * threshold.Value / 100, nil
+	}
+	return metrics.ConvertThreshold(threshold, unit)
+}
+
+// thresholdErrorResponse explains why a threshold couldn't be compared with its metric
+func thresholdErrorResponse(metric string, err error) datatypes.PerformanceSignatureReturn {
+	logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Couldn't convert the threshold of %v: %v", metric, err)})
+	return datatypes.PerformanceSignatureReturn{
+		Error:     true,
+		ErrorCode: datatypes.ErrorCodeInvalidRequest,
+		Response:  []string{fmt.Sprintf("Couldn't check %v: %v", metric, err)},
+	}
+}
@@ -1,62 +1,21 @@
 package performancesignature
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/dynatrace"
 	"github.com/barrebre/goDynaPerfSignature/logging"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func TestBuildDeploymentRequest(t *testing.T) {
-	type testDefs struct {
-		Name          string
-		Values        datatypes.PerformanceSignature
-		ExpectPass    bool
-		ExpectedError string
-	}
-
-	tests := []testDefs{
-		{
-			Name:       "Pass - valid params",
-			Values:     datatypes.GetValidDefaultPerformanceSignature(),
-			ExpectPass: true,
-		},
-		{
-			Name: "Pass - valid params with env",
-			Values: datatypes.PerformanceSignature{
-				DTEnv:    "POWEIFJPIOJAPSOIJ",
-				DTServer: "asdf1234.live.dynatrace.com",
-			},
-			ExpectPass: true,
-		},
-		{
-			Name: "Fail - couldn't build HTTP request",
-			Values: datatypes.PerformanceSignature{
-				DTEnv:    "",
-				DTServer: "\\",
-			},
-			ExpectPass:    false,
-			ExpectedError: "parse https://\\/api/v1/events?eventType=CUSTOM_DEPLOYMENT&entityId=: invalid character \"\\\\\" in host name",
-		},
-	}
-
-	for _, test := range tests {
-		t.Run(test.Name, func(t *testing.T) {
-			_, err := buildDeploymentRequest(test.Values)
-
-			if test.ExpectPass == true {
-				assert.NoError(t, err)
-			} else {
-				assert.Equal(t, err.Error(), test.ExpectedError)
-			}
-		})
-	}
-}
-
 func TestCheckPerfSignature(t *testing.T) {
 	type testDefs struct {
 		Name             string
@@ -137,6 +96,88 @@ func TestCheckPerfSignature(t *testing.T) {
 			ExpectedPass:     true,
 			ExpectedResponse: []string{"No previous metrics to compare against for metric dummy_metric_name:avg", "PASS - dummy_metric_name:percentile(90) is below the static threshold (1234.12) with a value of 12.34."},
 		},
+		{
+			Name:             "TestCheckPerfSignature - Only Current Window Queried - Static Check",
+			PerfSignature:    datatypes.GetValidStaticPerformanceSignature(),
+			MetricsResponse:  datatypes.ComparisonMetrics{CurrentMetrics: datatypes.GetValidFailingComparisonMetrics().CurrentMetrics},
+			ExpectedPass:     false,
+			ExpectedResponse: []string{"No previous metrics to compare against for metric dummy_metric_name:avg", "Metric degradation found: FAIL - dummy_metric_name:percentile(90) is above the static threshold (1234.12) with a value of 23456.00"},
+		},
+		{
+			Name: "TestCheckPerfSignature - Static Check With Units",
+			PerfSignature: datatypes.PerformanceSignature{
+				PSMetrics: map[string]datatypes.PSMetric{
+					"dummy_metric_name:percentile(90)": {
+						StaticThreshold:  datatypes.Threshold{Value: 20, Unit: "ms"},
+						ValidationMethod: "static",
+					},
+				},
+			},
+			MetricsResponse: datatypes.ComparisonMetrics{
+				CurrentMetrics: datatypes.GetValidFailingComparisonMetrics().CurrentMetrics,
+				Units:          map[string]string{"dummy_metric_name:percentile(90)": "MicroSecond"},
+			},
+			ExpectedPass:     false,
+			ExpectedResponse: []string{"No previous metrics to compare against for metric dummy_metric_name:avg", "Metric degradation found: FAIL - dummy_metric_name:percentile(90) is above the static threshold (20.00ms) with a value of 23.46ms"},
+		},
+		{
+			Name: "TestCheckPerfSignature - Relative Check With A Percentage",
+			PerfSignature: datatypes.PerformanceSignature{
+				PSMetrics: map[string]datatypes.PSMetric{
+					"dummy_metric_name:avg": {
+						RelativeThreshold: datatypes.Threshold{Value: 1, Unit: "%"},
+						ValidationMethod:  "relative",
+					},
+				},
+			},
+			MetricsResponse: datatypes.ComparisonMetrics{
+				CurrentMetrics:  datatypes.DynatraceMetricsResponse{Metrics: datatypes.GetValidFailingComparisonMetrics().CurrentMetrics.Metrics[:1]},
+				PreviousMetrics: datatypes.GetValidFailingComparisonMetrics().PreviousMetrics,
+			},
+			ExpectedPass:     true,
+			ExpectedResponse: []string{"PASS - dummy_metric_name:avg's current value is 1235.00, which is passable compared to the previous results (1234.12) plus the tolerance (12.34)."},
+		},
+		{
+			Name: "TestCheckPerfSignature - Threshold Unit Doesn't Match The Metric",
+			PerfSignature: datatypes.PerformanceSignature{
+				PSMetrics: map[string]datatypes.PSMetric{
+					"dummy_metric_name:avg": {
+						StaticThreshold:  datatypes.Threshold{Value: 2, Unit: "%"},
+						ValidationMethod: "static",
+					},
+				},
+			},
+			MetricsResponse: datatypes.ComparisonMetrics{
+				CurrentMetrics: datatypes.DynatraceMetricsResponse{Metrics: datatypes.GetValidFailingComparisonMetrics().CurrentMetrics.Metrics[:1]},
+				Units:          map[string]string{"dummy_metric_name:avg": "MicroSecond"},
+			},
+			ExpectedPass:     false,
+			ExpectedResponse: []string{"Couldn't check dummy_metric_name:avg: the threshold 2% can't be compared with a metric measured in MicroSecond"},
+		},
+		{
+			Name: "TestCheckPerfSignature - Static Check On The Worst Point",
+			PerfSignature: datatypes.PerformanceSignature{
+				PSMetrics: map[string]datatypes.PSMetric{
+					"dummy_metric_name:avg": {
+						SeriesAggregation: "max",
+						StaticThreshold:   datatypes.Threshold{Value: 100},
+						ValidationMethod:  "static",
+					},
+				},
+			},
+			MetricsResponse: datatypes.ComparisonMetrics{
+				CurrentMetrics: datatypes.DynatraceMetricsResponse{
+					Metrics: []datatypes.MetricValuesArray{
+						{
+							MetricId:     "dummy_metric_name:avg",
+							MetricValues: []datatypes.MetricValues{{Timestamps: []int64{1, 2, 3}, Values: []float64{50, 150, 40}}},
+						},
+					},
+				},
+			},
+			ExpectedPass:     false,
+			ExpectedResponse: []string{"Metric degradation found: FAIL - dummy_metric_name:avg is above the static threshold (100.00) with a value of 150.00"},
+		},
 	}
 
 	for _, test := range tests {
@@ -150,6 +191,222 @@ func TestCheckPerfSignature(t *testing.T) {
 
 }
 
+func TestGetServiceIDs(t *testing.T) {
+	type testDefs struct {
+		Name           string
+		Values         datatypes.PerformanceSignature
+		ExpectedResult []string
+	}
+
+	tests := []testDefs{
+		{
+			Name:           "Single ServiceID",
+			Values:         datatypes.PerformanceSignature{ServiceID: "SERVICE-1"},
+			ExpectedResult: []string{"SERVICE-1"},
+		},
+		{
+			Name: "ServiceID and ServiceIDs with duplicates",
+			Values: datatypes.PerformanceSignature{
+				ServiceID:  "SERVICE-1",
+				ServiceIDs: []string{"SERVICE-2", "SERVICE-1", "", "SERVICE-3"},
+			},
+			ExpectedResult: []string{"SERVICE-1", "SERVICE-2", "SERVICE-3"},
+		},
+		{
+			Name: "No services",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert.Equal(t, test.ExpectedResult, GetServiceIDs(test.Values))
+		})
+	}
+}
+
+func TestAggregateServiceResults(t *testing.T) {
+	type testDefs struct {
+		Name             string
+		Results          []datatypes.ServiceResult
+		Quorum           int
+		ExpectedPass     bool
+		ExpectedError    bool
+		ExpectedCode     string
+		ExpectedPending  bool
+		ExpectedRetry    int
+		ExpectedResponse []string
+	}
+
+	passing := datatypes.ServiceResult{ServiceID: "SERVICE-1", Pass: true}
+	failing := datatypes.ServiceResult{ServiceID: "SERVICE-2", Pass: false}
+	erroring := datatypes.ServiceResult{ServiceID: "SERVICE-3", Error: true, ErrorCode: datatypes.ErrorCodeNotFound}
+
+	tests := []testDefs{
+		{
+			Name:             "All services pass",
+			Results:          []datatypes.ServiceResult{passing, passing},
+			ExpectedPass:     true,
+			ExpectedResponse: []string{"PASS - 2 of 2 services passed (quorum 2)"},
+		},
+		{
+			Name:             "One service fails without a quorum",
+			Results:          []datatypes.ServiceResult{passing, failing},
+			ExpectedPass:     false,
+			ExpectedResponse: []string{"FAIL - 1 of 2 services passed (quorum 2)"},
+		},
+		{
+			Name:             "One service fails within the quorum",
+			Results:          []datatypes.ServiceResult{passing, failing},
+			Quorum:           1,
+			ExpectedPass:     true,
+			ExpectedResponse: []string{"PASS - 1 of 2 services passed (quorum 1)"},
+		},
+		{
+			Name:             "An error keeps the quorum from being reached",
+			Results:          []datatypes.ServiceResult{passing, erroring},
+			ExpectedPass:     false,
+			ExpectedError:    true,
+			ExpectedCode:     datatypes.ErrorCodeNotFound,
+			ExpectedResponse: []string{"FAIL - 1 of 2 services passed (quorum 2)", "1 services could not be evaluated"},
+		},
+		{
+			Name:             "A pending service could still reach the quorum",
+			Results:          []datatypes.ServiceResult{passing, {ServiceID: "SERVICE-4", Pending: true, RetryAfterSecs: 60}},
+			ExpectedPending:  true,
+			ExpectedRetry:    60,
+			ExpectedResponse: []string{"PENDING - 1 of 2 services passed (quorum 2)", "1 services have evaluation windows which have not finished"},
+		},
+		{
+			Name:             "An error within the quorum",
+			Results:          []datatypes.ServiceResult{passing, erroring},
+			Quorum:           1,
+			ExpectedPass:     true,
+			ExpectedResponse: []string{"PASS - 1 of 2 services passed (quorum 1)", "1 services could not be evaluated"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			response := aggregateServiceResults(test.Results, test.Quorum)
+
+			assert.Equal(t, test.ExpectedPass, response.Pass)
+			assert.Equal(t, test.ExpectedError, response.Error)
+			assert.Equal(t, test.ExpectedCode, response.ErrorCode)
+			assert.Equal(t, test.ExpectedPending, response.Pending)
+			assert.Equal(t, test.ExpectedRetry, response.RetryAfterSecs)
+			assert.Equal(t, test.ExpectedResponse, response.Response)
+			assert.Equal(t, test.Results, response.ServiceResults)
+		})
+	}
+}
+
+func TestProcessServiceIncompleteWindow(t *testing.T) {
+	type testDefs struct {
+		Name            string
+		WaitForWindow   bool
+		WaitLimit       time.Duration
+		ExpectedError   bool
+		ExpectedPending bool
+	}
+
+	tests := []testDefs{
+		{
+			Name:            "Pending when not waiting",
+			ExpectedPending: true,
+		},
+		{
+			Name:            "Pending when waiting without a limit",
+			WaitForWindow:   true,
+			ExpectedPending: true,
+		},
+		{
+			Name:            "Pending when the window closes after the limit",
+			WaitForWindow:   true,
+			WaitLimit:       time.Minute,
+			ExpectedPending: true,
+		},
+		{
+			Name:          "Cancelled while waiting",
+			WaitForWindow: true,
+			WaitLimit:     time.Hour,
+			ExpectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			ps := datatypes.GetValidDefaultPerformanceSignature()
+			ps.CurrentWindow = &datatypes.TimeWindow{From: "now-5m", To: "now+10m"}
+			ps.WaitForWindow = test.WaitForWindow
+
+			ctx, cancel := context.WithCancel(WithWaitLimit(context.Background(), test.WaitLimit))
+			cancel()
+
+			response := processService(ctx, ps)
+
+			assert.Equal(t, test.ExpectedError, response.Error)
+			assert.Equal(t, test.ExpectedPending, response.Pending)
+			assert.False(t, response.Pass)
+			if test.ExpectedPending {
+				assert.InDelta(t, 720, response.RetryAfterSecs, 5)
+			}
+		})
+	}
+}
+
+func TestProcessServiceWaitsForWindow(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result":[{"metricId":"dummy_metric_name:avg","data":[{"dimensions":["asdf"],"timestamps":[1234],"values":[1234.1234]}]}]}`))
+	}))
+	defer server.Close()
+
+	previousClient := dynatrace.DefaultClient()
+	dynatrace.SetDefaultClient(dynatrace.NewClientWithHTTP(server.Client()))
+	defer dynatrace.SetDefaultClient(previousClient)
+
+	// The window has closed, but its data is only complete a second from now
+	ps := datatypes.GetValidDefaultPerformanceSignature()
+	ps.DTServer = strings.TrimPrefix(server.URL, "https://")
+	ps.CurrentWindow = &datatypes.TimeWindow{From: "now-10m", To: "now-119s"}
+	ps.WaitForWindow = true
+	ps, err := pinTimeWindows(ps, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Now()
+	response := processService(WithWaitLimit(context.Background(), 5*time.Second), ps)
+
+	assert.False(t, response.Pending)
+	assert.False(t, response.Error, response.Response)
+	assert.True(t, response.Pass)
+	assert.True(t, time.Since(started) >= 500*time.Millisecond)
+}
+
+func TestProcessRequestCancelled(t *testing.T) {
+	ps := datatypes.GetValidDefaultPerformanceSignature()
+	ps.DTServer = "127.0.0.1:1"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	response := ProcessRequest(ctx, ps)
+
+	assert.True(t, response.Error)
+	assert.Equal(t, []string{"Evaluation stopped before it finished because the request was cancelled"}, response.Response)
+}
+
+func TestCancelledResponse(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+
+	response := cancelledResponse(ctx)
+
+	assert.True(t, response.Error)
+	assert.Equal(t, []string{"Evaluation stopped before it finished because the evaluation timed out"}, response.Response)
+}
+
 func TestPrintDeploymentTimestamps(t *testing.T) {
 	type testDefs struct {
 		Name   string
@@ -0,0 +1,129 @@
+package performancesignature
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/dynatrace"
+	"github.com/barrebre/goDynaPerfSignature/logging"
+)
+
+// deploymentEventSource is the source Dynatrace shows for the Deployment Events we push
+const deploymentEventSource = "goDynaPerfSignature"
+
+// ReadAndValidateDeploymentParams validates the body params sent to /deployment
+func ReadAndValidateDeploymentParams(b []byte, config datatypes.Config) (datatypes.DeploymentRequest, error) {
+	var dr datatypes.DeploymentRequest
+	err := json.Unmarshal(b, &dr)
+	if err != nil {
+		return datatypes.DeploymentRequest{}, err
+	}
+
+	tenant, err := findTenant(dr.Tenant, dr.APIToken, config)
+	if err != nil {
+		return datatypes.DeploymentRequest{}, err
+	}
+
+	err = checkEnvironmentOverride(tenant, dr.APIToken, dr.DTServer, dr.DTEnv)
+	if err != nil {
+		return datatypes.DeploymentRequest{}, err
+	}
+
+	// Apply the POST params over the goDynaPerfSignature config or the selected tenant
+	if dr.APIToken == "" {
+		dr.APIToken = tenant.APIToken
+	}
+
+	if dr.DTServer == "" {
+		dr.DTServer = tenant.Server
+	}
+
+	if dr.DTEnv == "" {
+		dr.DTEnv = tenant.Env
+	}
+
+	err = validateDeploymentParams(dr)
+	if err != nil {
+		return datatypes.DeploymentRequest{}, fmt.Errorf("Couldn't validate parameters: %v", err.Error())
+	}
+
+	return dr, nil
+}
+
+// Ensure there are no missing parameters to push a Deployment Event to Dynatrace
+func validateDeploymentParams(dr datatypes.DeploymentRequest) error {
+	if dr.APIToken == "" {
+		return fmt.Errorf("there is no DT_API_TOKEN env variable configured and no APIToken was passed with the POST")
+	}
+
+	if dr.DTServer == "" {
+		return fmt.Errorf("there is no DT_SERVER env variable configured and no DTServer was passed with the POST")
+	}
+
+	if dr.ServiceID == "" {
+		return fmt.Errorf("no ServiceID passed with the POST")
+	}
+
+	if dr.DeploymentName == "" {
+		return fmt.Errorf("no DeploymentName passed with the POST")
+	}
+
+	if dr.DeploymentVersion == "" {
+		return fmt.Errorf("no DeploymentVersion passed with the POST")
+	}
+
+	return nil
+}
+
+// PushDeployment creates a Deployment Event in Dynatrace for the requested service
+func PushDeployment(ctx context.Context, dr datatypes.DeploymentRequest) datatypes.DeploymentReturn {
+	env := dynatrace.Environment{
+		APIToken: dr.APIToken,
+		Env:      dr.DTEnv,
+		Server:   dr.DTServer,
+		Tenant:   dr.Tenant,
+	}
+
+	result, err := dynatrace.DefaultClient().PushDeploymentEvent(ctx, env, buildDeploymentEvent(dr))
+	if err != nil {
+		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Encountered error pushing deployment event: %v.", err)})
+		return datatypes.DeploymentReturn{
+			Error:     true,
+			ErrorCode: dynatrace.ErrorCode(err),
+			Response:  []string{fmt.Sprintf("Encountered error pushing deployment event to Dynatrace: %v", err)},
+		}
+	}
+
+	if len(result.StoredCorrelationIds) < 1 {
+		logging.LogError(datatypes.Logging{Message: "Dynatrace did not store the deployment event."})
+		return datatypes.DeploymentReturn{
+			Error:     true,
+			ErrorCode: datatypes.ErrorCodeNotFound,
+			Response:  []string{fmt.Sprintf("Dynatrace did not attach the deployment event to %v", dr.ServiceID)},
+		}
+	}
+
+	correlationID := result.StoredCorrelationIds[0]
+	logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Pushed deployment event %v for %v", correlationID, dr.ServiceID)})
+	return datatypes.DeploymentReturn{
+		CorrelationID: correlationID,
+		Response:      []string{fmt.Sprintf("Pushed deployment %v version %v for %v", dr.DeploymentName, dr.DeploymentVersion, dr.ServiceID)},
+	}
+}
+
+// Builds the Deployment Event pushed to Dynatrace
+func buildDeploymentEvent(dr datatypes.DeploymentRequest) datatypes.DeploymentEventPush {
+	return datatypes.DeploymentEventPush{
+		EventType: "CUSTOM_DEPLOYMENT",
+		AttachRules: datatypes.AttachRules{
+			EntityIds: []string{dr.ServiceID},
+		},
+		DeploymentName:    dr.DeploymentName,
+		DeploymentProject: dr.DeploymentProject,
+		DeploymentVersion: dr.DeploymentVersion,
+		Source:            deploymentEventSource,
+		CustomProperties:  dr.Properties,
+	}
+}
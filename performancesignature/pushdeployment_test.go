@@ -0,0 +1,144 @@
+package performancesignature
+
+import (
+	"testing"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAndValidateDeploymentParams(t *testing.T) {
+	type values struct {
+		APIString []byte
+		Config    datatypes.Config
+	}
+
+	type testDefs struct {
+		Name               string
+		Values             values
+		ExpectPass         bool
+		ExpectedError      string
+		ExpectedDeployment datatypes.DeploymentRequest
+	}
+
+	validJSON := `{"DeploymentName":"Deploy checkout","DeploymentVersion":"1.2.3","Properties":{"pipeline":"1234"},"ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	invalidJSONNoVersion := `{"DeploymentName":"Deploy checkout","ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	invalidJSONNoService := `{"DeploymentName":"Deploy checkout","DeploymentVersion":"1.2.3"}`
+	validJSONTenant := `{"DeploymentName":"Deploy checkout","DeploymentVersion":"1.2.3","ServiceID":"SERVICE-5D4E743B2BF0CCF5","Tenant":"staging"}`
+	invalidJSONRedirect := `{"DeploymentName":"Deploy checkout","DeploymentVersion":"1.2.3","DTEnv":"otherEnv","ServiceID":"SERVICE-5D4E743B2BF0CCF5"}`
+	invalidJSONTenant := `{"DeploymentName":"Deploy checkout","DeploymentVersion":"1.2.3","ServiceID":"SERVICE-5D4E743B2BF0CCF5","Tenant":"qa"}`
+
+	tests := []testDefs{
+		{
+			Name: "Pass - valid JSON with configured defaults",
+			Values: values{
+				APIString: []byte(validJSON),
+				Config:    datatypes.GetConfiguredConfig(),
+			},
+			ExpectPass: true,
+			ExpectedDeployment: datatypes.DeploymentRequest{
+				APIToken:          "aj0aw9efj0a9wejf09awejf",
+				DeploymentName:    "Deploy checkout",
+				DeploymentVersion: "1.2.3",
+				DTEnv:             "envSet",
+				DTServer:          "1234.live.dynatrace.com",
+				Properties: map[string]string{
+					"pipeline": "1234",
+				},
+				ServiceID: "SERVICE-5D4E743B2BF0CCF5",
+			},
+		},
+		{
+			Name: "Pass - tenant selected",
+			Values: values{
+				APIString: []byte(validJSONTenant),
+				Config:    datatypes.GetTenantsConfig(),
+			},
+			ExpectPass: true,
+			ExpectedDeployment: datatypes.DeploymentRequest{
+				APIToken:          "stagingtoken0a9wejf09a",
+				DeploymentName:    "Deploy checkout",
+				DeploymentVersion: "1.2.3",
+				DTEnv:             "stagingEnv",
+				DTServer:          "staging.live.dynatrace.com",
+				ServiceID:         "SERVICE-5D4E743B2BF0CCF5",
+				Tenant:            "staging",
+			},
+		},
+		{
+			Name: "Fail - unknown tenant",
+			Values: values{
+				APIString: []byte(invalidJSONTenant),
+				Config:    datatypes.GetTenantsConfig(),
+			},
+			ExpectPass:    false,
+			ExpectedError: "there is no tenant named qa",
+		},
+		{
+			Name: "Fail - configured token sent to another environment",
+			Values: values{
+				APIString: []byte(invalidJSONRedirect),
+				Config:    datatypes.GetConfiguredConfig(),
+			},
+			ExpectPass:    false,
+			ExpectedError: "a DTServer or DTEnv can only be passed with an APIToken, as the configured API token is only sent to its own environment",
+		},
+		{
+			Name: "Fail - no APIToken",
+			Values: values{
+				APIString: []byte(validJSON),
+			},
+			ExpectPass:    false,
+			ExpectedError: "Couldn't validate parameters: there is no DT_API_TOKEN env variable configured and no APIToken was passed with the POST",
+		},
+		{
+			Name: "Fail - no DeploymentVersion",
+			Values: values{
+				APIString: []byte(invalidJSONNoVersion),
+				Config:    datatypes.GetConfiguredConfig(),
+			},
+			ExpectPass:    false,
+			ExpectedError: "Couldn't validate parameters: no DeploymentVersion passed with the POST",
+		},
+		{
+			Name: "Fail - no ServiceID",
+			Values: values{
+				APIString: []byte(invalidJSONNoService),
+				Config:    datatypes.GetConfiguredConfig(),
+			},
+			ExpectPass:    false,
+			ExpectedError: "Couldn't validate parameters: no ServiceID passed with the POST",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			dr, err := ReadAndValidateDeploymentParams(test.Values.APIString, test.Values.Config)
+
+			if test.ExpectPass == true {
+				assert.NoError(t, err)
+				assert.Equal(t, test.ExpectedDeployment, dr)
+			} else {
+				assert.EqualError(t, err, test.ExpectedError)
+			}
+		})
+	}
+}
+
+func TestBuildDeploymentEvent(t *testing.T) {
+	event := buildDeploymentEvent(datatypes.GetValidDeploymentRequest())
+
+	assert.Equal(t, datatypes.DeploymentEventPush{
+		EventType: "CUSTOM_DEPLOYMENT",
+		AttachRules: datatypes.AttachRules{
+			EntityIds: []string{"SERVICE-5D4E743B2BF0CCF5"},
+		},
+		DeploymentName:    "Deploy checkout",
+		DeploymentVersion: "1.2.3",
+		Source:            "goDynaPerfSignature",
+		CustomProperties: map[string]string{
+			"pipeline": "1234",
+		},
+	}, event)
+}
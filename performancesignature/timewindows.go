@@ -0,0 +1,132 @@
+package performancesignature
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/logging"
+)
+
+var relativeTimeRegex = regexp.MustCompile(`^now(?:([+-])(\d+)([smhdw]))?$`)
+
+var relativeTimeUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// hasExplicitWindows reports whether the request provided its own timeframes instead of relying on Deployment Events
+func hasExplicitWindows(ps datatypes.PerformanceSignature) bool {
+	return ps.CurrentWindow != nil
+}
+
+// resolveTimeWindows turns the explicit windows of a request into Timestamps, with the current window first
+func resolveTimeWindows(ps datatypes.PerformanceSignature, now time.Time) ([]datatypes.Timestamps, error) {
+	if ps.CurrentWindow == nil {
+		return []datatypes.Timestamps{}, fmt.Errorf("no CurrentWindow was provided")
+	}
+
+	current, err := resolveTimeWindow(*ps.CurrentWindow, now)
+	if err != nil {
+		return []datatypes.Timestamps{}, fmt.Errorf("invalid CurrentWindow: %v", err)
+	}
+	timestamps := []datatypes.Timestamps{current}
+
+	if ps.BaselineWindow != nil {
+		baseline, err := resolveTimeWindow(*ps.BaselineWindow, now)
+		if err != nil {
+			return []datatypes.Timestamps{}, fmt.Errorf("invalid BaselineWindow: %v", err)
+		}
+		timestamps = append(timestamps, baseline)
+	}
+
+	logging.LogDebug(datatypes.Logging{Message: fmt.Sprintf("Resolved explicit windows to %v", timestamps)})
+	return timestamps, nil
+}
+
+// pinTimeWindows replaces the explicit windows of a request with the epoch milliseconds they resolve to at now, so an
+// evaluation which waits for its window, or is run again later, still evaluates the window that was asked for
+func pinTimeWindows(ps datatypes.PerformanceSignature, now time.Time) (datatypes.PerformanceSignature, error) {
+	timestamps, err := resolveTimeWindows(ps, now)
+	if err != nil {
+		return datatypes.PerformanceSignature{}, err
+	}
+
+	ps.CurrentWindow = pinnedTimeWindow(timestamps[0])
+	if len(timestamps) > 1 {
+		ps.BaselineWindow = pinnedTimeWindow(timestamps[1])
+	}
+	return ps, nil
+}
+
+// pinnedTimeWindow turns resolved Timestamps back into a TimeWindow
+func pinnedTimeWindow(ts datatypes.Timestamps) *datatypes.TimeWindow {
+	return &datatypes.TimeWindow{
+		From: strconv.FormatInt(ts.StartTime, 10),
+		To:   strconv.FormatInt(ts.EndTime, 10),
+	}
+}
+
+// resolveTimeWindow converts a single TimeWindow into Timestamps
+func resolveTimeWindow(window datatypes.TimeWindow, now time.Time) (datatypes.Timestamps, error) {
+	from, err := parseTimeExpression(window.From, now)
+	if err != nil {
+		return datatypes.Timestamps{}, fmt.Errorf("could not parse From: %v", err)
+	}
+
+	// An empty To means the window runs until now
+	to := now.UnixNano() / int64(time.Millisecond)
+	if window.To != "" {
+		to, err = parseTimeExpression(window.To, now)
+		if err != nil {
+			return datatypes.Timestamps{}, fmt.Errorf("could not parse To: %v", err)
+		}
+	}
+
+	if from >= to {
+		return datatypes.Timestamps{}, fmt.Errorf("From (%v) must be before To (%v)", from, to)
+	}
+
+	return datatypes.Timestamps{
+		StartTime: from,
+		EndTime:   to,
+	}, nil
+}
+
+// parseTimeExpression reads epoch milliseconds, RFC3339 timestamps, or relative expressions like now-30m into epoch
+// milliseconds
+func parseTimeExpression(expr string, now time.Time) (int64, error) {
+	if expr == "" {
+		return 0, fmt.Errorf("no time was provided")
+	}
+
+	if millis, err := strconv.ParseInt(expr, 10, 64); err == nil {
+		return millis, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, expr); err == nil {
+		return t.UnixNano() / int64(time.Millisecond), nil
+	}
+
+	matches := relativeTimeRegex.FindStringSubmatch(expr)
+	if matches == nil {
+		return 0, fmt.Errorf("'%v' is not epoch milliseconds, an RFC3339 timestamp, or a relative time like now-30m", expr)
+	}
+
+	t := now
+	if matches[1] != "" {
+		amount, _ := strconv.Atoi(matches[2])
+		offset := time.Duration(amount) * relativeTimeUnits[matches[3]]
+		if matches[1] == "-" {
+			offset = -offset
+		}
+		t = now.Add(offset)
+	}
+
+	return t.UnixNano() / int64(time.Millisecond), nil
+}
@@ -0,0 +1,187 @@
+package performancesignature
+
+import (
+	"testing"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeExpression(t *testing.T) {
+	type testDefs struct {
+		Name           string
+		Value          string
+		ExpectPass     bool
+		ExpectedError  string
+		ExpectedResult int64
+	}
+
+	now := time.Unix(1600000000, 0)
+
+	tests := []testDefs{
+		{
+			Name:           "Pass - epoch milliseconds",
+			Value:          "1598818148000",
+			ExpectPass:     true,
+			ExpectedResult: 1598818148000,
+		},
+		{
+			Name:           "Pass - RFC3339",
+			Value:          "2020-09-13T12:26:40Z",
+			ExpectPass:     true,
+			ExpectedResult: 1600000000000,
+		},
+		{
+			Name:           "Pass - now",
+			Value:          "now",
+			ExpectPass:     true,
+			ExpectedResult: 1600000000000,
+		},
+		{
+			Name:           "Pass - now-30m",
+			Value:          "now-30m",
+			ExpectPass:     true,
+			ExpectedResult: 1599998200000,
+		},
+		{
+			Name:           "Pass - now-1d",
+			Value:          "now-1d",
+			ExpectPass:     true,
+			ExpectedResult: 1599913600000,
+		},
+		{
+			Name:          "Fail - empty",
+			Value:         "",
+			ExpectPass:    false,
+			ExpectedError: "no time was provided",
+		},
+		{
+			Name:          "Fail - unknown unit",
+			Value:         "now-3y",
+			ExpectPass:    false,
+			ExpectedError: "'now-3y' is not epoch milliseconds, an RFC3339 timestamp, or a relative time like now-30m",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			result, err := parseTimeExpression(test.Value, now)
+
+			if test.ExpectPass == true {
+				assert.NoError(t, err)
+				assert.Equal(t, test.ExpectedResult, result)
+			} else {
+				assert.EqualError(t, err, test.ExpectedError)
+			}
+		})
+	}
+}
+
+func TestResolveTimeWindows(t *testing.T) {
+	type testDefs struct {
+		Name           string
+		Values         datatypes.PerformanceSignature
+		ExpectPass     bool
+		ExpectedError  string
+		ExpectedResult []datatypes.Timestamps
+	}
+
+	now := time.Unix(1600000000, 0)
+
+	tests := []testDefs{
+		{
+			Name: "Pass - current window only",
+			Values: datatypes.PerformanceSignature{
+				CurrentWindow: &datatypes.TimeWindow{From: "now-30m"},
+			},
+			ExpectPass: true,
+			ExpectedResult: []datatypes.Timestamps{
+				{
+					StartTime: 1599998200000,
+					EndTime:   1600000000000,
+				},
+			},
+		},
+		{
+			Name: "Pass - current and baseline windows",
+			Values: datatypes.PerformanceSignature{
+				CurrentWindow:  &datatypes.TimeWindow{From: "now-30m", To: "now"},
+				BaselineWindow: &datatypes.TimeWindow{From: "now-1d", To: "1599915400000"},
+			},
+			ExpectPass: true,
+			ExpectedResult: []datatypes.Timestamps{
+				{
+					StartTime: 1599998200000,
+					EndTime:   1600000000000,
+				},
+				{
+					StartTime: 1599913600000,
+					EndTime:   1599915400000,
+				},
+			},
+		},
+		{
+			Name:          "Fail - no current window",
+			Values:        datatypes.PerformanceSignature{},
+			ExpectPass:    false,
+			ExpectedError: "no CurrentWindow was provided",
+		},
+		{
+			Name: "Fail - From after To",
+			Values: datatypes.PerformanceSignature{
+				CurrentWindow: &datatypes.TimeWindow{From: "now", To: "now-30m"},
+			},
+			ExpectPass:    false,
+			ExpectedError: "invalid CurrentWindow: From (1600000000000) must be before To (1599998200000)",
+		},
+		{
+			Name: "Fail - invalid baseline",
+			Values: datatypes.PerformanceSignature{
+				CurrentWindow:  &datatypes.TimeWindow{From: "now-30m"},
+				BaselineWindow: &datatypes.TimeWindow{From: "yesterday"},
+			},
+			ExpectPass:    false,
+			ExpectedError: "invalid BaselineWindow: could not parse From: 'yesterday' is not epoch milliseconds, an RFC3339 timestamp, or a relative time like now-30m",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			result, err := resolveTimeWindows(test.Values, now)
+
+			if test.ExpectPass == true {
+				assert.NoError(t, err)
+				assert.Equal(t, test.ExpectedResult, result)
+			} else {
+				assert.EqualError(t, err, test.ExpectedError)
+			}
+		})
+	}
+}
+
+func TestPinTimeWindows(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+
+	ps := datatypes.PerformanceSignature{
+		CurrentWindow:  &datatypes.TimeWindow{From: "now-30m"},
+		BaselineWindow: &datatypes.TimeWindow{From: "now-1d-30m", To: "now-1d"},
+	}
+	_, err := pinTimeWindows(ps, now)
+	assert.Error(t, err)
+
+	ps.BaselineWindow = &datatypes.TimeWindow{From: "now-25h", To: "now-24h"}
+	pinned, err := pinTimeWindows(ps, now)
+	assert.NoError(t, err)
+	assert.Equal(t, &datatypes.TimeWindow{From: "1599998200000", To: "1600000000000"}, pinned.CurrentWindow)
+	assert.Equal(t, &datatypes.TimeWindow{From: "1599910000000", To: "1599913600000"}, pinned.BaselineWindow)
+
+	// Pinned windows resolve to the same times later on
+	later, err := resolveTimeWindows(pinned, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, []datatypes.Timestamps{{StartTime: 1599998200000, EndTime: 1600000000000}, {StartTime: 1599910000000, EndTime: 1599913600000}}, later)
+
+	// The request's own windows are left alone
+	assert.Equal(t, &datatypes.TimeWindow{From: "now-30m"}, ps.CurrentWindow)
+}
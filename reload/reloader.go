@@ -0,0 +1,297 @@
+package reload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/dynatrace"
+	"github.com/barrebre/goDynaPerfSignature/evaluations"
+	"github.com/barrebre/goDynaPerfSignature/logging"
+	"github.com/barrebre/goDynaPerfSignature/signatures"
+	"github.com/barrebre/goDynaPerfSignature/tokens"
+	"github.com/barrebre/goDynaPerfSignature/utils"
+)
+
+// Reloader holds the config in effect, and swaps in a new one when the config file or the signatures directory
+// change. A new config only replaces the current one once everything it needs has loaded, so an invalid config
+// leaves the current one in place
+type Reloader struct {
+	lock       sync.RWMutex
+	config     datatypes.Config
+	tokenFiles *tokens.FileProvider
+
+	// reloading makes sure only one reload runs at a time. The fingerprints are what the config file and signatures
+	// directory looked like when they were last loaded
+	reloading             sync.Mutex
+	configFingerprint     string
+	signaturesFingerprint string
+}
+
+// New returns a Reloader for the config loaded at startup. tokenFiles is updated with the token files of each new
+// config
+func New(config datatypes.Config, tokenFiles *tokens.FileProvider) *Reloader {
+	return &Reloader{
+		config:                config,
+		tokenFiles:            tokenFiles,
+		configFingerprint:     configFingerprint(config.ConfigFile),
+		signaturesFingerprint: signaturesFingerprint(config.SignaturesDir),
+	}
+}
+
+// Config returns the config in effect
+func (r *Reloader) Config() datatypes.Config {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.config
+}
+
+// Reload loads the config file and the signatures directory again, whether or not they changed. The Dynatrace
+// client is rebuilt as well, so a CA file which was replaced in place is read again
+func (r *Reloader) Reload() {
+	r.reloading.Lock()
+	defer r.reloading.Unlock()
+
+	r.reloadConfig(true)
+	r.reloadSignatures()
+}
+
+// Check reloads the config file or the signatures directory if they changed since they were last loaded
+func (r *Reloader) Check() {
+	r.reloading.Lock()
+	defer r.reloading.Unlock()
+
+	if configFingerprint(r.Config().ConfigFile) != r.configFingerprint {
+		r.reloadConfig(false)
+	}
+
+	if signaturesFingerprint(r.Config().SignaturesDir) != r.signaturesFingerprint {
+		r.reloadSignatures()
+	}
+}
+
+// Watch checks for changes every interval until the context is done. An interval of 0 turns watching off
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Check()
+		}
+	}
+}
+
+// reloadConfig loads the config file and swaps it in, if it is valid
+func (r *Reloader) reloadConfig(rebuildClient bool) {
+	previous := r.Config()
+
+	// Remember the file even if it turns out to be invalid, so it isn't loaded and rejected again every check
+	r.configFingerprint = configFingerprint(previous.ConfigFile)
+
+	config, err := utils.ReloadConfig(previous.ConfigFile)
+	if err == nil {
+		err = r.apply(previous, config, rebuildClient)
+	}
+	if err != nil {
+		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Keeping the current config, as the new one is invalid: %v", err)})
+		return
+	}
+
+	changes := utils.ConfigChanges(previous, config)
+	if len(changes) == 0 {
+		logging.LogSystem(datatypes.Logging{Message: "Reloaded the config, which has not changed"})
+		return
+	}
+	logging.LogSystem(datatypes.Logging{Message: fmt.Sprintf("Reloaded the config: %v", strings.Join(changes, "; "))})
+}
+
+// apply loads everything a new config needs, and only then swaps it all in
+func (r *Reloader) apply(previous datatypes.Config, config datatypes.Config, rebuildClient bool) error {
+	var client *dynatrace.Client
+	if rebuildClient || clientSettings(previous) != clientSettings(config) {
+		var err error
+		client, err = dynatrace.NewClient(config)
+		if err != nil {
+			return fmt.Errorf("could not configure the Dynatrace client: %w", err)
+		}
+	}
+
+	tokenFiles := tokens.FilesFromConfig(config)
+	if err := tokens.NewFileProvider(tokenFiles).Check(); err != nil {
+		return fmt.Errorf("could not read the API tokens: %w", err)
+	}
+
+	// A new directory needs a Registry of its own. Without any, the current signatures are kept, as they would
+	// otherwise all be dropped
+	var registry *signatures.Registry
+	if config.SignaturesDir != previous.SignaturesDir && config.SignaturesDir != "" {
+		var err error
+		registry, err = signatures.LoadDir(config.SignaturesDir)
+		if err != nil {
+			return fmt.Errorf("could not load the signatures: %w", err)
+		}
+	}
+
+	if client != nil {
+		dynatrace.SetDefaultClient(client)
+	}
+	if r.tokenFiles != nil {
+		r.tokenFiles.SetPaths(tokenFiles)
+	}
+	if registry != nil {
+		r.signaturesFingerprint = signaturesFingerprint(config.SignaturesDir)
+		swapSignatures(registry)
+	} else if config.SignaturesDir != previous.SignaturesDir {
+		r.signaturesFingerprint = ""
+		logging.LogSystem(datatypes.Logging{Message: fmt.Sprintf("Keeping the signatures from %v until a restart, as signaturesDir was removed", previous.SignaturesDir)})
+	}
+	evaluations.SetCallbackAllowedHosts(config.CallbackAllowedHosts)
+	logging.SetLogLevel(config.LogLevel)
+
+	r.lock.Lock()
+	r.config = config
+	r.lock.Unlock()
+
+	return nil
+}
+
+// reloadSignatures reads the signatures directory into the default Registry again, if every signature in it is
+// valid. The Registry itself is kept, so changes made through it while the directory is read aren't lost
+func (r *Reloader) reloadSignatures() {
+	dir := r.Config().SignaturesDir
+	r.signaturesFingerprint = signaturesFingerprint(dir)
+	if dir == "" {
+		return
+	}
+
+	registry := signatures.DefaultRegistry()
+	previous := registry.List()
+	if err := registry.Reload(); err != nil {
+		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Keeping the current signatures: could not load the signatures: %v", err)})
+		return
+	}
+	logSignatureChanges(previous, registry.List())
+}
+
+// swapSignatures replaces the default Registry with one for another directory
+func swapSignatures(registry *signatures.Registry) {
+	previous := signatures.DefaultRegistry().List()
+	signatures.SetDefaultRegistry(registry)
+	logSignatureChanges(previous, registry.List())
+}
+
+// logSignatureChanges logs which signatures changed with a reload
+func logSignatureChanges(previous []datatypes.Signature, current []datatypes.Signature) {
+	changes := signatureChanges(previous, current)
+	if len(changes) == 0 {
+		logging.LogSystem(datatypes.Logging{Message: "Reloaded the signatures, which have not changed"})
+		return
+	}
+	logging.LogSystem(datatypes.Logging{Message: fmt.Sprintf("Reloaded the signatures: %v", strings.Join(changes, "; "))})
+}
+
+// signatureChanges describes which signatures were added, changed or removed between two lists sorted by name
+func signatureChanges(previous []datatypes.Signature, current []datatypes.Signature) []string {
+	var added, changed, removed []string
+
+	previousByName := map[string]datatypes.Signature{}
+	for _, signature := range previous {
+		previousByName[signature.Name] = signature
+	}
+	currentByName := map[string]datatypes.Signature{}
+	for _, signature := range current {
+		currentByName[signature.Name] = signature
+	}
+
+	for _, currentSignature := range current {
+		previousSignature, ok := previousByName[currentSignature.Name]
+		if !ok {
+			added = append(added, currentSignature.Name)
+			continue
+		}
+
+		if !reflect.DeepEqual(previousSignature, currentSignature) {
+			changed = append(changed, currentSignature.Name)
+		}
+	}
+
+	for _, previousSignature := range previous {
+		if _, ok := currentByName[previousSignature.Name]; !ok {
+			removed = append(removed, previousSignature.Name)
+		}
+	}
+
+	var changes []string
+	if len(added) > 0 {
+		changes = append(changes, "added "+strings.Join(added, ", "))
+	}
+	if len(changed) > 0 {
+		changes = append(changes, "changed "+strings.Join(changed, ", "))
+	}
+	if len(removed) > 0 {
+		changes = append(changes, "removed "+strings.Join(removed, ", "))
+	}
+	return changes
+}
+
+// clientSettings describes the settings the Dynatrace client is built with. The client is only rebuilt when these
+// change, so its cache survives other changes
+func clientSettings(config datatypes.Config) string {
+	settings := fmt.Sprintf("%v|%v|%v|%v|%v|%v", config.CachePastTTLSecs, config.CacheTTLSecs, config.CAFile, config.MaxRetries, config.Proxy, config.TimeoutSecs)
+
+	var names []string
+	for name := range config.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		settings += fmt.Sprintf("|%v:%v:%v", name, config.Tenants[name].CAFile, config.Tenants[name].Proxy)
+	}
+	return settings
+}
+
+// configFingerprint hashes the config file. An unreadable file has a fingerprint of its own, so it is only
+// reported once
+func configFingerprint(path string) string {
+	if path == "" {
+		return ""
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// signaturesFingerprint summarizes the signatures directory, in the same way as configFingerprint
+func signaturesFingerprint(dir string) string {
+	if dir == "" {
+		return ""
+	}
+
+	fingerprint, err := signatures.Fingerprint(dir)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return fingerprint
+}
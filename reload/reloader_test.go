@@ -0,0 +1,159 @@
+package reload
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/dynatrace"
+	"github.com/barrebre/goDynaPerfSignature/signatures"
+	"github.com/barrebre/goDynaPerfSignature/tokens"
+	"github.com/barrebre/goDynaPerfSignature/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+const checkoutSignature = `PSMetrics:
+  builtin:service.response.time:avg:
+    ValidationMethod: static
+    StaticThreshold: 500ms
+`
+
+func writeFile(t *testing.T, path string, contents string) {
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloader(t *testing.T) {
+	previousRegistry := signatures.DefaultRegistry()
+	defer signatures.SetDefaultRegistry(previousRegistry)
+	previousClient := dynatrace.DefaultClient()
+	defer dynatrace.SetDefaultClient(previousClient)
+
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	signaturesDir := filepath.Join(dir, "signatures")
+	if err := os.Mkdir(signaturesDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(signaturesDir, "checkout-api.yaml"), checkoutSignature)
+
+	configFile := filepath.Join(dir, "config.yaml")
+	writeFile(t, configFile, "signaturesDir: "+signaturesDir+"\ndefaults:\n  eventAge: 7\n")
+
+	config, err := utils.GetConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := signatures.LoadDir(signaturesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatures.SetDefaultRegistry(registry)
+
+	tokenFiles := tokens.NewFileProvider(tokens.FilesFromConfig(config))
+	reloader := New(config, tokenFiles)
+
+	// Nothing changed
+	reloader.Check()
+	assert.Equal(t, 7, reloader.Config().DefaultEventAge)
+	assert.Equal(t, registry, signatures.DefaultRegistry())
+
+	// A valid change is swapped in
+	writeFile(t, configFile, "signaturesDir: "+signaturesDir+"\ndefaults:\n  eventAge: 14\n")
+	reloader.Check()
+	assert.Equal(t, 14, reloader.Config().DefaultEventAge)
+
+	// An invalid one is not
+	writeFile(t, configFile, "signaturesDir: "+signaturesDir+"\ndefaults:\n  eventAge: -1\n")
+	reloader.Check()
+	assert.Equal(t, 14, reloader.Config().DefaultEventAge)
+
+	// Neither is a config whose token file can't be read
+	writeFile(t, configFile, "signaturesDir: "+signaturesDir+"\ndynatrace:\n  apiTokenFile: "+filepath.Join(dir, "missing")+"\n")
+	reloader.Check()
+	assert.Equal(t, 14, reloader.Config().DefaultEventAge)
+	assert.Equal(t, "", reloader.Config().APITokenFile)
+
+	// A new signature is picked up
+	writeFile(t, filepath.Join(signaturesDir, "search-api.yaml"), checkoutSignature)
+	reloader.Check()
+	assert.Equal(t, []string{"checkout-api", "search-api"}, signatures.DefaultRegistry().Names())
+
+	// An invalid signature keeps the current ones
+	writeFile(t, filepath.Join(signaturesDir, "broken.yaml"), "PSMetrics: {}\n")
+	reloader.Check()
+	assert.Equal(t, []string{"checkout-api", "search-api"}, signatures.DefaultRegistry().Names())
+
+	// Reload loads everything again, even without changes
+	os.Remove(filepath.Join(signaturesDir, "broken.yaml"))
+	writeFile(t, configFile, "signaturesDir: "+signaturesDir+"\n")
+	reloader.Reload()
+	assert.Equal(t, 0, reloader.Config().DefaultEventAge)
+	assert.NotEqual(t, previousClient, dynatrace.DefaultClient())
+
+	// Signatures are reloaded into the same Registry, keeping the ones changed through it
+	login := datatypes.GetValidSignature()
+	login.Name = "login-api"
+	_, err = registry.Put(login)
+	assert.NoError(t, err)
+	reloader.Reload()
+	assert.Equal(t, registry, signatures.DefaultRegistry())
+	assert.Equal(t, []string{"checkout-api", "login-api", "search-api"}, signatures.DefaultRegistry().Names())
+
+	// Removing the signatures directory keeps the current signatures
+	writeFile(t, configFile, "defaults:\n  eventAge: 3\n")
+	reloader.Check()
+	assert.Equal(t, 3, reloader.Config().DefaultEventAge)
+	reloader.Reload()
+	assert.Equal(t, registry, signatures.DefaultRegistry())
+	assert.Equal(t, []string{"checkout-api", "login-api", "search-api"}, signatures.DefaultRegistry().Names())
+}
+
+func TestSignatureChanges(t *testing.T) {
+	previous := signatures.NewRegistry()
+	current := signatures.NewRegistry()
+
+	assert.Empty(t, signatureChanges(previous.List(), current.List()))
+
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(dir, "checkout-api.yaml"), checkoutSignature)
+	writeFile(t, filepath.Join(dir, "search-api.yaml"), checkoutSignature)
+	previous, err = signatures.LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Remove(filepath.Join(dir, "search-api.yaml"))
+	writeFile(t, filepath.Join(dir, "checkout-api.yaml"), checkoutSignature+"EvaluationMins: 10\n")
+	writeFile(t, filepath.Join(dir, "login-api.yaml"), checkoutSignature)
+	current, err = signatures.LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"added login-api", "changed checkout-api", "removed search-api"}, signatureChanges(previous.List(), current.List()))
+}
+
+func TestClientSettings(t *testing.T) {
+	config := datatypes.GetTenantsConfig()
+	changed := config
+	changed.DefaultEventAge = 30
+	assert.Equal(t, clientSettings(config), clientSettings(changed))
+
+	changed.Tenants = map[string]datatypes.Tenant{
+		"staging": {CAFile: "/etc/ssl/staging.pem", Server: "staging.live.dynatrace.com"},
+	}
+	assert.NotEqual(t, clientSettings(config), clientSettings(changed))
+}
@@ -0,0 +1,290 @@
+package signatures
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/metrics"
+
+	"gopkg.in/yaml.v2"
+)
+
+// validName keeps signature names usable in URLs and file names
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Registry holds the signatures requests can reference by name, along with every earlier version of them
+type Registry struct {
+	lock       sync.RWMutex
+	signatures map[string]datatypes.Signature
+
+	// versions holds every version of each signature, including deleted signatures, so past evaluations can be
+	// traced back to the definition they used
+	versions map[string]map[int]datatypes.Signature
+
+	// dir is where changes are saved. files is the file each current signature was loaded from or saved to
+	dir   string
+	files map[string]string
+}
+
+var (
+	defaultRegistry     = NewRegistry()
+	defaultRegistryLock sync.RWMutex
+)
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		signatures: map[string]datatypes.Signature{},
+		versions:   map[string]map[int]datatypes.Signature{},
+		files:      map[string]string{},
+	}
+}
+
+// SetDefaultRegistry replaces the Registry returned by DefaultRegistry
+func SetDefaultRegistry(registry *Registry) {
+	defaultRegistryLock.Lock()
+	defer defaultRegistryLock.Unlock()
+	defaultRegistry = registry
+}
+
+// DefaultRegistry returns the Registry loaded at startup
+func DefaultRegistry() *Registry {
+	defaultRegistryLock.RLock()
+	defer defaultRegistryLock.RUnlock()
+	return defaultRegistry
+}
+
+// LoadDir reads every .yaml, .yml and .json file in dir as a signature. A signature without a Name is named after
+// its file. Any invalid file fails the whole load, so a typo can't silently drop a signature. Changes made through
+// the Registry are saved back to dir
+func LoadDir(dir string) (*Registry, error) {
+	return loadDir(dir, nil)
+}
+
+// loadDir reads dir like LoadDir. known holds versions which may not have been saved yet, so a file edited since
+// they were loaded becomes a new version rather than replacing one of them
+func loadDir(dir string, known map[string]map[int]datatypes.Signature) (*Registry, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the signatures directory %v: %w", dir, err)
+	}
+
+	// Read the versions first, so each file can be compared with the latest version of its signature
+	registry := NewRegistry()
+	registry.dir = dir
+	if err := registry.loadVersions(); err != nil {
+		return nil, err
+	}
+	for _, versions := range known {
+		for version, signature := range versions {
+			if _, ok := registry.versions[signature.Name][version]; !ok {
+				registry.addVersion(signature)
+			}
+		}
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !isSignatureFile(file.Name()) {
+			continue
+		}
+
+		path := filepath.Join(dir, file.Name())
+		signature, err := readSignatureFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := registry.signatures[signature.Name]; ok {
+			return nil, fmt.Errorf("invalid signature %v: another file already defines the signature %v", path, signature.Name)
+		}
+
+		signature, err = registry.fileVersion(signature)
+		if err != nil {
+			return nil, err
+		}
+		registry.signatures[signature.Name] = signature
+		registry.files[signature.Name] = path
+	}
+
+	return registry, nil
+}
+
+// Reload reads the directory the Registry was loaded from again, replacing its signatures with the ones there now.
+// Put and Delete save their changes to the directory and wait for a reload to finish, so none of them are lost, and
+// files edited by hand become new versions. A Registry without a directory is left as it is
+func (r *Registry) Reload() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.dir == "" {
+		return nil
+	}
+
+	loaded, err := loadDir(r.dir, r.versions)
+	if err != nil {
+		return err
+	}
+
+	r.signatures = loaded.signatures
+	r.versions = loaded.versions
+	r.files = loaded.files
+	return nil
+}
+
+// Fingerprint summarizes the names, sizes and modification times of the signature files in dir, so a watcher can
+// tell when any of them changed without reading them
+func Fingerprint(dir string) (string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("could not read the signatures directory %v: %w", dir, err)
+	}
+
+	var fingerprint strings.Builder
+	for _, file := range files {
+		if file.IsDir() || !isSignatureFile(file.Name()) {
+			continue
+		}
+		fmt.Fprintf(&fingerprint, "%v|%v|%v\n", file.Name(), file.Size(), file.ModTime().UnixNano())
+	}
+	return fingerprint.String(), nil
+}
+
+// isSignatureFile checks whether a file name has one of the extensions signatures are read from
+func isSignatureFile(name string) bool {
+	extension := strings.ToLower(filepath.Ext(name))
+	return extension == ".yaml" || extension == ".yml" || extension == ".json"
+}
+
+// readSignatureFile parses the signature in a file. A file without a Version is version 1, until fileVersion compares it
+// with the versions already known
+func readSignatureFile(path string) (datatypes.Signature, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return datatypes.Signature{}, fmt.Errorf("could not read the signature %v: %w", path, err)
+	}
+
+	name := filepath.Base(path)
+	signature, err := Parse(data, strings.TrimSuffix(name, filepath.Ext(name)))
+	if err != nil {
+		return datatypes.Signature{}, fmt.Errorf("invalid signature %v: %w", path, err)
+	}
+
+	if signature.Version < 1 {
+		signature.Version = 1
+	}
+	return signature, nil
+}
+
+// Get returns the signature with the name. The bool is false if there is none
+func (r *Registry) Get(name string) (datatypes.Signature, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	signature, ok := r.signatures[name]
+	return signature, ok
+}
+
+// Names returns the names of every signature, sorted
+func (r *Registry) Names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	names := []string{}
+	for name := range r.signatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List returns every current signature, sorted by name
+func (r *Registry) List() []datatypes.Signature {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	list := []datatypes.Signature{}
+	for _, signature := range r.signatures {
+		list = append(list, signature)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Parse reads a signature from YAML or JSON. Both are read with the same rules as a request, so thresholds with
+// units and the other PSMetrics settings work the same way. defaultName is used if the signature has no Name
+func Parse(data []byte, defaultName string) (datatypes.Signature, error) {
+	// JSON is valid YAML, so both formats go through the YAML parser
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return datatypes.Signature{}, err
+	}
+
+	converted, err := json.Marshal(toJSONValue(raw))
+	if err != nil {
+		return datatypes.Signature{}, err
+	}
+
+	var signature datatypes.Signature
+	if err := json.Unmarshal(converted, &signature); err != nil {
+		return datatypes.Signature{}, err
+	}
+
+	if signature.Name == "" {
+		signature.Name = defaultName
+	}
+
+	if err := Validate(signature); err != nil {
+		return datatypes.Signature{}, err
+	}
+	return signature, nil
+}
+
+// Validate checks a signature with the same rules as the PSMetrics of a request
+func Validate(signature datatypes.Signature) error {
+	if !validName.MatchString(signature.Name) {
+		return fmt.Errorf("the signature name '%v' may only contain letters, numbers, '.', '_' and '-'", signature.Name)
+	}
+
+	if len(signature.PSMetrics) == 0 {
+		return fmt.Errorf("the signature %v has no PSMetrics", signature.Name)
+	}
+
+	if signature.EvaluationMins < 0 {
+		return fmt.Errorf("the EvaluationMins cannot be negative")
+	}
+
+	if !metrics.IsValidResolution(signature.Resolution) {
+		return fmt.Errorf("the Resolution '%v' must be Inf, a number of data points, or a timespan like 1m", signature.Resolution)
+	}
+
+	if !metrics.IsValidSeriesAggregation(signature.SeriesAggregation) {
+		return fmt.Errorf("the SeriesAggregation '%v' must be avg, min, max, last, or a percentile like p95", signature.SeriesAggregation)
+	}
+
+	return metrics.ValidatePSMetrics(signature.PSMetrics)
+}
+
+// toJSONValue converts the maps the YAML parser produces, which have interface{} keys, into maps JSON can encode
+func toJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		converted := map[string]interface{}{}
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = toJSONValue(item)
+		}
+		return converted
+	case []interface{}:
+		for i, item := range v {
+			v[i] = toJSONValue(item)
+		}
+		return v
+	}
+	return value
+}
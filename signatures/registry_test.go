@@ -0,0 +1,254 @@
+package signatures
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSignatureDir creates a temporary directory with the files, returning a func which removes it again
+func writeSignatureDir(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "signatures")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+const checkoutYAML = `
+EvaluationMins: 10
+PSMetrics:
+  builtin:service.response.time:avg:
+    StaticThreshold: 500ms
+    ValidationMethod: static
+  builtin:service.errors.total.rate:avg:
+    RelativeThreshold: 1
+    ValidationMethod: relative
+`
+
+const searchJSON = `{"Name":"search","PSMetrics":{"builtin:service.response.time:avg":{"StaticThreshold":250,"ValidationMethod":"static"}},"Resolution":"1m"}`
+
+func TestLoadDir(t *testing.T) {
+	type testDefs struct {
+		Name          string
+		Files         map[string]string
+		ExpectedNames []string
+		ExpectedError string
+	}
+
+	tests := []testDefs{
+		{
+			Name: "YAML and JSON files",
+			Files: map[string]string{
+				"checkout-api.yaml": checkoutYAML,
+				"other.json":        searchJSON,
+				"notes.txt":         "not a signature",
+			},
+			ExpectedNames: []string{"checkout-api", "search"},
+		},
+		{
+			Name:          "Empty directory",
+			Files:         map[string]string{},
+			ExpectedNames: []string{},
+		},
+		{
+			Name: "Invalid signature",
+			Files: map[string]string{
+				"broken.yml": "PSMetrics: {}",
+			},
+			ExpectedError: "the signature broken has no PSMetrics",
+		},
+		{
+			Name: "Duplicate names",
+			Files: map[string]string{
+				"a.json": searchJSON,
+				"b.json": searchJSON,
+			},
+			ExpectedError: "another file already defines the signature search",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			dir, cleanup := writeSignatureDir(t, test.Files)
+			defer cleanup()
+
+			registry, err := LoadDir(dir)
+
+			if test.ExpectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, test.ExpectedNames, registry.Names())
+			} else {
+				assert.Error(t, err)
+				assert.True(t, strings.HasPrefix(err.Error(), "invalid signature "+dir), err.Error())
+				assert.True(t, strings.HasSuffix(err.Error(), test.ExpectedError), err.Error())
+			}
+		})
+	}
+
+	_, err := LoadDir("/does/not/exist")
+	assert.Error(t, err)
+}
+
+func TestParse(t *testing.T) {
+	type testDefs struct {
+		Name              string
+		Data              string
+		ExpectedSignature datatypes.Signature
+		ExpectPass        bool
+		ExpectedError     string
+	}
+
+	tests := []testDefs{
+		{
+			Name: "YAML named after its file",
+			Data: checkoutYAML,
+			ExpectedSignature: datatypes.Signature{
+				Name:           "checkout-api",
+				EvaluationMins: 10,
+				PSMetrics: map[string]datatypes.PSMetric{
+					"builtin:service.response.time:avg": {
+						StaticThreshold:  datatypes.Threshold{Value: 500, Unit: "ms"},
+						ValidationMethod: "static",
+					},
+					"builtin:service.errors.total.rate:avg": {
+						RelativeThreshold: datatypes.Threshold{Value: 1},
+						ValidationMethod:  "relative",
+					},
+				},
+			},
+			ExpectPass: true,
+		},
+		{
+			Name: "JSON with its own name",
+			Data: searchJSON,
+			ExpectedSignature: datatypes.Signature{
+				Name: "search",
+				PSMetrics: map[string]datatypes.PSMetric{
+					"builtin:service.response.time:avg": {
+						StaticThreshold:  datatypes.Threshold{Value: 250},
+						ValidationMethod: "static",
+					},
+				},
+				Resolution: "1m",
+			},
+			ExpectPass: true,
+		},
+		{
+			Name:          "Invalid YAML",
+			Data:          "PSMetrics: [",
+			ExpectedError: "yaml: line 1: did not find expected node content",
+		},
+		{
+			Name:          "Invalid threshold",
+			Data:          `{"PSMetrics":{"metric":{"StaticThreshold":"fast"}}}`,
+			ExpectedError: "could not read the threshold 'fast': it must start with a number",
+		},
+		{
+			Name:          "Invalid name",
+			Data:          `{"Name":"../etc","PSMetrics":{"metric":{}}}`,
+			ExpectedError: "the signature name '../etc' may only contain letters, numbers, '.', '_' and '-'",
+		},
+		{
+			Name:          "Invalid metric",
+			Data:          `{"PSMetrics":{"metric":{"SeriesAggregation":"worst"}}}`,
+			ExpectedError: "the SeriesAggregation 'worst' of metric must be avg, min, max, last, or a percentile like p95",
+		},
+		{
+			Name:          "Invalid resolution",
+			Data:          `{"PSMetrics":{"metric":{}},"Resolution":"1 minute"}`,
+			ExpectedError: "the Resolution '1 minute' must be Inf, a number of data points, or a timespan like 1m",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			signature, err := Parse([]byte(test.Data), "checkout-api")
+
+			if test.ExpectPass {
+				assert.NoError(t, err)
+				assert.Equal(t, test.ExpectedSignature, signature)
+			} else {
+				assert.EqualError(t, err, test.ExpectedError)
+			}
+		})
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	previous := DefaultRegistry()
+	defer SetDefaultRegistry(previous)
+
+	registry := NewRegistry()
+	SetDefaultRegistry(registry)
+	assert.Equal(t, registry, DefaultRegistry())
+
+	_, ok := DefaultRegistry().Get("checkout-api")
+	assert.False(t, ok)
+}
+
+func TestExampleSignatures(t *testing.T) {
+	// Loading saves the first version of each signature, so load a copy rather than the examples themselves
+	examples, err := ioutil.ReadDir("../examples/signatures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, example := range examples {
+		data, err := ioutil.ReadFile(filepath.Join("../examples/signatures", example.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[example.Name()] = string(data)
+	}
+	dir, cleanup := writeSignatureDir(t, files)
+	defer cleanup()
+
+	registry, err := LoadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"checkout-api"}, registry.Names())
+}
+
+func TestFingerprint(t *testing.T) {
+	dir, cleanup := writeSignatureDir(t, map[string]string{
+		"checkout-api.yaml": "PSMetrics: {}\n",
+		"notes.txt":         "not a signature",
+	})
+	defer cleanup()
+
+	fingerprint, err := Fingerprint(dir)
+	assert.NoError(t, err)
+	assert.Contains(t, fingerprint, "checkout-api.yaml")
+	assert.NotContains(t, fingerprint, "notes.txt")
+
+	// Temporary files written while saving a signature don't count
+	if err := ioutil.WriteFile(filepath.Join(dir, "checkout-api.yaml.tmp"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	unchanged, err := Fingerprint(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, fingerprint, unchanged)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "search-api.json"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := Fingerprint(dir)
+	assert.NoError(t, err)
+	assert.NotEqual(t, fingerprint, changed)
+
+	_, err = Fingerprint(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
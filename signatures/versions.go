@@ -0,0 +1,256 @@
+package signatures
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/logging"
+)
+
+// versionsDir is the directory in the signatures directory which keeps every version of each signature. It is
+// hidden, so LoadDir doesn't read the old versions as current signatures
+const versionsDir = ".versions"
+
+// ErrNotFound is returned when there is no signature with the requested name or version
+var ErrNotFound = errors.New("signature not found")
+
+// ErrNoDir is returned when a signature is changed without a signatures directory to keep it in, as it and its
+// versions would be lost on restart, while the history still referenced them
+var ErrNoDir = errors.New("signatures can only be changed when DT_SIGNATURES_DIR is set")
+
+// GetVersion returns a specific version of a signature, even if the signature was changed or deleted since
+func (r *Registry) GetVersion(name string, version int) (datatypes.Signature, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	signature, ok := r.versions[name][version]
+	return signature, ok
+}
+
+// Versions returns every version of a signature, oldest first
+func (r *Registry) Versions(name string) []datatypes.Signature {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	versions := []datatypes.Signature{}
+	for _, signature := range r.versions[name] {
+		versions = append(versions, signature)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions
+}
+
+// Put validates a signature and stores it as the next version of its name, returning the stored signature
+func (r *Registry) Put(signature datatypes.Signature) (datatypes.Signature, error) {
+	if err := Validate(signature); err != nil {
+		return datatypes.Signature{}, err
+	}
+	if r.dir == "" {
+		return datatypes.Signature{}, ErrNoDir
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// Versions keep counting after a delete, so a recreated signature can't be mistaken for the deleted one
+	signature.Version = 1
+	for version := range r.versions[signature.Name] {
+		if version >= signature.Version {
+			signature.Version = version + 1
+		}
+	}
+	now := time.Now().UTC()
+	signature.UpdatedAt = &now
+
+	// Make sure the version being replaced is kept too, in case it was only ever loaded from its file
+	if current, ok := r.signatures[signature.Name]; ok {
+		if err := r.writeVersion(current); err != nil {
+			return datatypes.Signature{}, err
+		}
+	}
+	if err := r.writeVersion(signature); err != nil {
+		return datatypes.Signature{}, err
+	}
+
+	path, ok := r.files[signature.Name]
+	if !ok {
+		path = filepath.Join(r.dir, signature.Name+".json")
+	}
+	if err := writeJSONFile(path, signature); err != nil {
+		return datatypes.Signature{}, err
+	}
+	r.files[signature.Name] = path
+
+	r.signatures[signature.Name] = signature
+	r.addVersion(signature)
+	return signature, nil
+}
+
+// Delete removes a signature, so requests can no longer reference it. Its versions are kept
+func (r *Registry) Delete(name string) error {
+	if r.dir == "" {
+		return ErrNoDir
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	current, ok := r.signatures[name]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if path, ok := r.files[name]; ok {
+		if err := r.writeVersion(current); err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not delete the signature %v: %w", path, err)
+		}
+	}
+
+	delete(r.signatures, name)
+	delete(r.files, name)
+	return nil
+}
+
+// addVersion remembers a version of a signature. The caller must hold the lock, or be the only one using the
+// Registry
+func (r *Registry) addVersion(signature datatypes.Signature) {
+	if r.versions[signature.Name] == nil {
+		r.versions[signature.Name] = map[int]datatypes.Signature{}
+	}
+	r.versions[signature.Name][signature.Version] = signature
+}
+
+// loadVersions reads the versions saved in the signatures directory. A missing versions directory just means no
+// version was saved yet
+func (r *Registry) loadVersions() error {
+	names, err := ioutil.ReadDir(filepath.Join(r.dir, versionsDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read the signature versions: %w", err)
+	}
+
+	for _, name := range names {
+		if !name.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join(r.dir, versionsDir, name.Name())
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("could not read the versions of the signature %v: %w", name.Name(), err)
+		}
+
+		for _, file := range files {
+			if file.IsDir() || !isSignatureFile(file.Name()) {
+				continue
+			}
+
+			signature, err := readSignatureFile(filepath.Join(dir, file.Name()))
+			if err != nil {
+				return err
+			}
+
+			r.addVersion(signature)
+		}
+	}
+
+	return nil
+}
+
+// fileVersion works out which version the signature in a file is. A file matching the latest version of its signature
+// is that version. One which doesn't was edited by hand, and is saved as the next version, so a version evaluations
+// were recorded with never changes. The caller must hold the lock, or be the only one using the Registry
+func (r *Registry) fileVersion(signature datatypes.Signature) (datatypes.Signature, error) {
+	latest, ok := r.latestVersion(signature.Name)
+	if !ok {
+		// Save the first version seen, so an edit made while goDynaPerfSignature is stopped is noticed too
+		r.addVersion(signature)
+		if err := r.writeVersion(signature); err != nil {
+			logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Edits to the signature %v made while goDynaPerfSignature is stopped won't create a new version: %v", signature.Name, err)})
+		}
+		return signature, nil
+	}
+
+	if sameDefinition(latest, signature) {
+		return latest, nil
+	}
+
+	now := time.Now().UTC()
+	signature.Version = latest.Version + 1
+	signature.UpdatedAt = &now
+
+	// The version being replaced may only have been loaded from its file so far
+	if err := r.writeVersion(latest); err != nil {
+		return datatypes.Signature{}, err
+	}
+	if err := r.writeVersion(signature); err != nil {
+		return datatypes.Signature{}, err
+	}
+	r.addVersion(signature)
+	return signature, nil
+}
+
+// latestVersion returns the highest version of a signature, including one which was deleted
+func (r *Registry) latestVersion(name string) (datatypes.Signature, bool) {
+	var latest datatypes.Signature
+	found := false
+	for version, signature := range r.versions[name] {
+		if !found || version > latest.Version {
+			latest = signature
+			found = true
+		}
+	}
+	return latest, found
+}
+
+// sameDefinition checks whether two signatures evaluate the same way, whatever their Version and UpdatedAt
+func sameDefinition(a datatypes.Signature, b datatypes.Signature) bool {
+	a.Version, b.Version = 0, 0
+	a.UpdatedAt, b.UpdatedAt = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+// writeVersion saves a version of a signature, unless it is already saved
+func (r *Registry) writeVersion(signature datatypes.Signature) error {
+	path := filepath.Join(r.dir, versionsDir, signature.Name, fmt.Sprintf("%d.json", signature.Version))
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("could not save version %v of the signature %v: %w", signature.Version, signature.Name, err)
+	}
+	return writeJSONFile(path, signature)
+}
+
+// writeJSONFile replaces a file with the JSON of a signature. It writes to a temporary file first, so a failure
+// can't leave a half-written signature behind. JSON is valid YAML, so this works for .yaml files as well
+func writeJSONFile(path string, signature datatypes.Signature) error {
+	data, err := json.MarshalIndent(signature, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal the signature %v: %w", signature.Name, err)
+	}
+
+	temp := path + ".tmp"
+	if err := ioutil.WriteFile(temp, data, 0600); err != nil {
+		return fmt.Errorf("could not save the signature %v: %w", signature.Name, err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("could not save the signature %v: %w", signature.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package signatures
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/stretchr/testify/assert"
+)
+
+// versionNumbers lists the versions of a signature
+func versionNumbers(signatures []datatypes.Signature) []int {
+	versions := []int{}
+	for _, signature := range signatures {
+		versions = append(versions, signature.Version)
+	}
+	return versions
+}
+
+func TestPutWithoutDir(t *testing.T) {
+	registry := NewRegistry()
+
+	_, err := registry.Put(datatypes.GetValidSignature())
+	assert.Equal(t, ErrNoDir, err)
+	assert.Equal(t, ErrNoDir, registry.Delete("checkout-api"))
+	assert.Empty(t, registry.Names())
+	assert.Empty(t, registry.Versions("checkout-api"))
+}
+
+func TestPutVersions(t *testing.T) {
+	dir, cleanup := writeSignatureDir(t, nil)
+	defer cleanup()
+
+	registry, err := LoadDir(dir)
+	assert.NoError(t, err)
+
+	first, err := registry.Put(datatypes.GetValidSignature())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, first.Version)
+	assert.NotNil(t, first.UpdatedAt)
+
+	changed := datatypes.GetValidSignature()
+	delete(changed.PSMetrics, "builtin:service.errors.total.rate:avg")
+	second, err := registry.Put(changed)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, second.Version)
+
+	current, ok := registry.Get("checkout-api")
+	assert.True(t, ok)
+	assert.Equal(t, second, current)
+
+	old, ok := registry.GetVersion("checkout-api", 1)
+	assert.True(t, ok)
+	assert.Len(t, old.PSMetrics, 2)
+
+	assert.Equal(t, []int{1, 2}, versionNumbers(registry.Versions("checkout-api")))
+	assert.Empty(t, registry.Versions("search"))
+
+	invalid := datatypes.GetValidSignature()
+	invalid.SeriesAggregation = "worst"
+	_, err = registry.Put(invalid)
+	assert.EqualError(t, err, "the SeriesAggregation 'worst' must be avg, min, max, last, or a percentile like p95")
+	assert.Equal(t, []int{1, 2}, versionNumbers(registry.Versions("checkout-api")))
+}
+
+func TestPutAndDeleteInDir(t *testing.T) {
+	dir, cleanup := writeSignatureDir(t, map[string]string{"checkout-api.yaml": checkoutYAML})
+	defer cleanup()
+
+	registry, err := LoadDir(dir)
+	assert.NoError(t, err)
+
+	loaded, _ := registry.Get("checkout-api")
+	assert.Equal(t, 1, loaded.Version)
+
+	// Changing a signature loaded from YAML keeps its file
+	changed := datatypes.GetValidSignature()
+	changed.EvaluationMins = 15
+	_, err = registry.Put(changed)
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "checkout-api.json"))
+	assert.True(t, os.IsNotExist(err))
+
+	// A new signature gets a JSON file
+	search := datatypes.GetValidSignature()
+	search.Name = "search"
+	_, err = registry.Put(search)
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "search.json"))
+	assert.NoError(t, err)
+
+	reloaded, err := LoadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"checkout-api", "search"}, reloaded.Names())
+	current, _ := reloaded.Get("checkout-api")
+	assert.Equal(t, 2, current.Version)
+	assert.Equal(t, 15, current.EvaluationMins)
+	first, ok := reloaded.GetVersion("checkout-api", 1)
+	assert.True(t, ok)
+	assert.Equal(t, 10, first.EvaluationMins)
+
+	// Deleting keeps the versions, and recreating continues counting
+	assert.NoError(t, reloaded.Delete("checkout-api"))
+	assert.Equal(t, ErrNotFound, reloaded.Delete("checkout-api"))
+	_, err = os.Stat(filepath.Join(dir, "checkout-api.yaml"))
+	assert.True(t, os.IsNotExist(err))
+
+	afterDelete, err := LoadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"search"}, afterDelete.Names())
+	assert.Equal(t, []int{1, 2}, versionNumbers(afterDelete.Versions("checkout-api")))
+
+	recreated, err := afterDelete.Put(datatypes.GetValidSignature())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, recreated.Version)
+
+	files, _ := ioutil.ReadDir(filepath.Join(dir, versionsDir, "checkout-api"))
+	assert.Len(t, files, 3)
+}
+
+func TestReload(t *testing.T) {
+	dir, cleanup := writeSignatureDir(t, map[string]string{"checkout-api.yaml": checkoutYAML})
+	defer cleanup()
+
+	registry, err := LoadDir(dir)
+	assert.NoError(t, err)
+
+	// Signatures changed through the Registry are still there after a reload, along with new files
+	search := datatypes.GetValidSignature()
+	search.Name = "search"
+	_, err = registry.Put(search)
+	assert.NoError(t, err)
+	if err := ioutil.WriteFile(filepath.Join(dir, "login-api.yaml"), []byte(checkoutYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, registry.Reload())
+	assert.Equal(t, []string{"checkout-api", "login-api", "search"}, registry.Names())
+	assert.Equal(t, []int{1}, versionNumbers(registry.Versions("search")))
+
+	// An invalid file keeps the current signatures
+	if err := ioutil.WriteFile(filepath.Join(dir, "broken.yaml"), []byte("PSMetrics: {}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, registry.Reload())
+	assert.Equal(t, []string{"checkout-api", "login-api", "search"}, registry.Names())
+
+	// Without a directory, there is nothing to reload
+	empty := NewRegistry()
+	assert.NoError(t, empty.Reload())
+	assert.Empty(t, empty.Names())
+}
+
+func TestHandEditedVersions(t *testing.T) {
+	dir, cleanup := writeSignatureDir(t, map[string]string{"checkout-api.yaml": checkoutYAML})
+	defer cleanup()
+	path := filepath.Join(dir, "checkout-api.yaml")
+
+	registry, err := LoadDir(dir)
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, versionsDir, "checkout-api", "1.json"))
+	assert.NoError(t, err)
+
+	// An unchanged file stays the same version
+	assert.NoError(t, registry.Reload())
+	assert.Equal(t, []int{1}, versionNumbers(registry.Versions("checkout-api")))
+
+	// An edited file becomes the next version, leaving the first one as it was
+	edited := strings.Replace(checkoutYAML, "500ms", "900ms", 1)
+	if err := ioutil.WriteFile(path, []byte(edited), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, registry.Reload())
+	assert.Equal(t, []int{1, 2}, versionNumbers(registry.Versions("checkout-api")))
+	current, _ := registry.Get("checkout-api")
+	assert.Equal(t, 2, current.Version)
+	assert.NotNil(t, current.UpdatedAt)
+	assert.Equal(t, 900.0, current.PSMetrics["builtin:service.response.time:avg"].StaticThreshold.Value)
+	first, _ := registry.GetVersion("checkout-api", 1)
+	assert.Equal(t, 500.0, first.PSMetrics["builtin:service.response.time:avg"].StaticThreshold.Value)
+
+	assert.NoError(t, registry.Reload())
+	assert.Equal(t, []int{1, 2}, versionNumbers(registry.Versions("checkout-api")))
+
+	// Edits made while stopped are noticed on the next start
+	if err := ioutil.WriteFile(path, []byte(strings.Replace(checkoutYAML, "500ms", "700ms", 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := LoadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, versionNumbers(restarted.Versions("checkout-api")))
+	second, _ := restarted.GetVersion("checkout-api", 2)
+	assert.Equal(t, 900.0, second.PSMetrics["builtin:service.response.time:avg"].StaticThreshold.Value)
+
+	// So are edits to a file written by Put, which keeps the Version it was saved with
+	changed := datatypes.GetValidSignature()
+	stored, err := restarted.Put(changed)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, stored.Version)
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	if err := ioutil.WriteFile(path, []byte(strings.Replace(string(data), `"500ms"`, `"650ms"`, 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, restarted.Reload())
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, versionNumbers(restarted.Versions("checkout-api")))
+	fourth, _ := restarted.GetVersion("checkout-api", 4)
+	assert.Equal(t, 500.0, fourth.PSMetrics["builtin:service.response.time:avg"].StaticThreshold.Value)
+	fifth, _ := restarted.Get("checkout-api")
+	assert.Equal(t, 650.0, fifth.PSMetrics["builtin:service.response.time:avg"].StaticThreshold.Value)
+}
@@ -0,0 +1,114 @@
+package tokens
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/logging"
+)
+
+// FileProvider reads each tenant's token from a file, such as a mounted Kubernetes secret. A file is read again
+// whenever its modification time or size changes, so rotated tokens are picked up without a restart
+type FileProvider struct {
+	lock  sync.Mutex
+	paths map[string]string
+	files map[string]tokenFile
+}
+
+// tokenFile is the last token read from a file, along with what the file looked like at the time
+type tokenFile struct {
+	modTime time.Time
+	size    int64
+	token   datatypes.Secret
+}
+
+// NewFileProvider returns a FileProvider reading the tokens of the tenants from the given paths
+func NewFileProvider(paths map[string]string) *FileProvider {
+	return &FileProvider{
+		paths: paths,
+		files: map[string]tokenFile{},
+	}
+}
+
+// FilesFromConfig returns the token file paths of the config, keyed by tenant. The top-level Dynatrace settings are
+// under the empty name
+func FilesFromConfig(config datatypes.Config) map[string]string {
+	paths := map[string]string{}
+	if config.APITokenFile != "" {
+		paths[""] = config.APITokenFile
+	}
+	for name, tenant := range config.Tenants {
+		if tenant.APITokenFile != "" {
+			paths[name] = tenant.APITokenFile
+		}
+	}
+	return paths
+}
+
+// SetPaths replaces the token files, such as when the config is reloaded
+func (p *FileProvider) SetPaths(paths map[string]string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.paths = paths
+}
+
+// Token returns the token in the tenant's file, or an empty token if the tenant has no file
+func (p *FileProvider) Token(tenant string) (datatypes.Secret, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	path, ok := p.paths[tenant]
+	if !ok {
+		return "", nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read the token file %v: %w", path, err)
+	}
+
+	cached, ok := p.files[path]
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.token, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read the token file %v: %w", path, err)
+	}
+
+	token := datatypes.Secret(strings.TrimSpace(string(b)))
+	if token == "" {
+		return "", fmt.Errorf("the token file %v is empty", path)
+	}
+
+	if ok {
+		logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Reloaded the API token from %v", path)})
+	}
+	p.files[path] = tokenFile{modTime: info.ModTime(), size: info.Size(), token: token}
+	return token, nil
+}
+
+// Check reads every token file, so a missing or empty one is noticed at startup rather than on the first request
+func (p *FileProvider) Check() error {
+	p.lock.Lock()
+	var tenants []string
+	for tenant := range p.paths {
+		tenants = append(tenants, tenant)
+	}
+	p.lock.Unlock()
+	sort.Strings(tenants)
+
+	for _, tenant := range tenants {
+		if _, err := p.Token(tenant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package tokens
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	prodFile := filepath.Join(dir, "prod")
+	if err := ioutil.WriteFile(prodFile, []byte("dt0c01.first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := NewFileProvider(map[string]string{"prod": prodFile, "staging": filepath.Join(dir, "missing")})
+
+	token, err := provider.Token("prod")
+	assert.NoError(t, err)
+	assert.Equal(t, datatypes.Secret("dt0c01.first"), token)
+
+	// Tenants without a file are left to the config
+	token, err = provider.Token("managed")
+	assert.NoError(t, err)
+	assert.Equal(t, datatypes.Secret(""), token)
+
+	_, err = provider.Token("staging")
+	assert.Error(t, err)
+	assert.Error(t, provider.Check())
+
+	// A rotated token is read again
+	if err := ioutil.WriteFile(prodFile, []byte("dt0c01.second\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(prodFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err = provider.Token("prod")
+	assert.NoError(t, err)
+	assert.Equal(t, datatypes.Secret("dt0c01.second"), token)
+
+	if err := ioutil.WriteFile(prodFile, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.Token("prod")
+	assert.EqualError(t, err, "the token file "+prodFile+" is empty")
+}
+
+func TestFileProviderSetPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "prod")
+	if err := ioutil.WriteFile(tokenFile, []byte("dt0c01.prod"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := NewFileProvider(map[string]string{})
+	token, err := provider.Token("prod")
+	assert.NoError(t, err)
+	assert.Equal(t, datatypes.Secret(""), token)
+
+	provider.SetPaths(map[string]string{"prod": tokenFile})
+	token, err = provider.Token("prod")
+	assert.NoError(t, err)
+	assert.Equal(t, datatypes.Secret("dt0c01.prod"), token)
+}
+
+func TestFilesFromConfig(t *testing.T) {
+	config := datatypes.Config{
+		APITokenFile: "/var/run/secrets/default",
+		Tenants: map[string]datatypes.Tenant{
+			"prod":    {APITokenFile: "/var/run/secrets/prod", Server: "prod.live.dynatrace.com"},
+			"staging": {APIToken: "dt0c01.staging", Server: "staging.live.dynatrace.com"},
+		},
+	}
+
+	assert.Equal(t, map[string]string{
+		"":     "/var/run/secrets/default",
+		"prod": "/var/run/secrets/prod",
+	}, FilesFromConfig(config))
+}
@@ -0,0 +1,57 @@
+package tokens
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+)
+
+// Provider supplies the Dynatrace API tokens of the configured environments. The tenant is the name of a tenant
+// profile, or empty for the top-level Dynatrace settings. A Provider returns an empty token for the tenants it has
+// no token for, so the token in the config is used instead. Providers must be safe for concurrent use
+type Provider interface {
+	Token(tenant string) (datatypes.Secret, error)
+}
+
+// noProvider has no tokens, leaving every tenant to the tokens in the config
+type noProvider struct{}
+
+func (noProvider) Token(tenant string) (datatypes.Secret, error) {
+	return "", nil
+}
+
+var (
+	defaultProvider     Provider = noProvider{}
+	defaultProviderLock sync.RWMutex
+)
+
+// SetDefaultProvider replaces the Provider returned by DefaultProvider
+func SetDefaultProvider(provider Provider) {
+	defaultProviderLock.Lock()
+	defer defaultProviderLock.Unlock()
+	defaultProvider = provider
+}
+
+// DefaultProvider returns the Provider configured at startup
+func DefaultProvider() Provider {
+	defaultProviderLock.RLock()
+	defer defaultProviderLock.RUnlock()
+	return defaultProvider
+}
+
+// Resolve returns the token of a tenant from the default Provider, falling back to the token in the config
+func Resolve(tenant string, configured datatypes.Secret) (datatypes.Secret, error) {
+	token, err := DefaultProvider().Token(tenant)
+	if err != nil {
+		if tenant == "" {
+			return "", fmt.Errorf("could not get the API token: %w", err)
+		}
+		return "", fmt.Errorf("could not get the API token of the tenant %v: %w", tenant, err)
+	}
+
+	if token == "" {
+		return configured, nil
+	}
+	return token, nil
+}
@@ -0,0 +1,86 @@
+package tokens
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/stretchr/testify/assert"
+)
+
+// staticProvider is a Provider with fixed tokens, standing in for a vault
+type staticProvider map[string]datatypes.Secret
+
+func (p staticProvider) Token(tenant string) (datatypes.Secret, error) {
+	return p[tenant], nil
+}
+
+// failingProvider is a Provider which can't be reached
+type failingProvider struct{}
+
+func (failingProvider) Token(tenant string) (datatypes.Secret, error) {
+	return "", errors.New("vault sealed")
+}
+
+func TestResolve(t *testing.T) {
+	previous := DefaultProvider()
+	defer SetDefaultProvider(previous)
+
+	type testDefs struct {
+		Name          string
+		Provider      Provider
+		Tenant        string
+		Configured    datatypes.Secret
+		ExpectedToken datatypes.Secret
+		ExpectedError string
+	}
+
+	tests := []testDefs{
+		{
+			Name:          "No provider",
+			Provider:      noProvider{},
+			Configured:    "from-config",
+			ExpectedToken: "from-config",
+		},
+		{
+			Name:          "Provider token",
+			Provider:      staticProvider{"prod": "from-vault"},
+			Tenant:        "prod",
+			Configured:    "from-config",
+			ExpectedToken: "from-vault",
+		},
+		{
+			Name:          "Provider without the tenant",
+			Provider:      staticProvider{"prod": "from-vault"},
+			Tenant:        "staging",
+			Configured:    "from-config",
+			ExpectedToken: "from-config",
+		},
+		{
+			Name:          "Provider error",
+			Provider:      failingProvider{},
+			Tenant:        "prod",
+			ExpectedError: "could not get the API token of the tenant prod: vault sealed",
+		},
+		{
+			Name:          "Provider error for the default environment",
+			Provider:      failingProvider{},
+			ExpectedError: "could not get the API token: vault sealed",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			SetDefaultProvider(test.Provider)
+
+			token, err := Resolve(test.Tenant, test.Configured)
+			if test.ExpectedError != "" {
+				assert.EqualError(t, err, test.ExpectedError)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.ExpectedToken, token)
+		})
+	}
+}
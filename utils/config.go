@@ -0,0 +1,565 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/barrebre/goDynaPerfSignature/datatypes"
+	"github.com/barrebre/goDynaPerfSignature/dynatrace"
+	"github.com/barrebre/goDynaPerfSignature/logging"
+
+	"gopkg.in/yaml.v2"
+)
+
+// tenantNameRegex matches the names tenants can be selected by
+var tenantNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// configFile is the layout of the YAML config file. Settings which are left out keep their defaults. Settings where
+// 0 means something are pointers, so leaving them out can be told apart from setting them to 0
+type configFile struct {
+	ListenAddress     string `yaml:"listenAddress"`
+	Port              int    `yaml:"port"`
+	EvaluationWorkers int    `yaml:"evaluationWorkers"`
+	HistoryFile       string `yaml:"historyFile"`
+	SignaturesDir     string `yaml:"signaturesDir"`
+
+	// CallbackAllowedHosts are the only hosts callbacks may be sent to, if any are listed
+	CallbackAllowedHosts []string `yaml:"callbackAllowedHosts"`
+
+	// ReloadIntervalSecs is how often the config file and signatures directory are checked for changes
+	ReloadIntervalSecs *int `yaml:"reloadIntervalSecs"`
+
+	Timeouts struct {
+		ReadSecs     int `yaml:"readSecs"`
+		WriteSecs    int `yaml:"writeSecs"`
+		IdleSecs     int `yaml:"idleSecs"`
+		ShutdownSecs int `yaml:"shutdownSecs"`
+	} `yaml:"timeouts"`
+
+	Defaults struct {
+		EventAge       int `yaml:"eventAge"`
+		EvaluationMins int `yaml:"evaluationMins"`
+	} `yaml:"defaults"`
+
+	Dynatrace struct {
+		Server           string           `yaml:"server"`
+		Env              string           `yaml:"env"`
+		APIToken         datatypes.Secret `yaml:"apiToken"`
+		APITokenFile     string           `yaml:"apiTokenFile"`
+		CAFile           string           `yaml:"caFile"`
+		Proxy            string           `yaml:"proxy"`
+		TimeoutSecs      int              `yaml:"timeoutSecs"`
+		MaxRetries       *int             `yaml:"maxRetries"`
+		CacheTTLSecs     *int             `yaml:"cacheTTLSecs"`
+		CachePastTTLSecs *int             `yaml:"cachePastTTLSecs"`
+	} `yaml:"dynatrace"`
+
+	Tenants map[string]tenantFile `yaml:"tenants"`
+
+	Logging struct {
+		Level string `yaml:"level"`
+	} `yaml:"logging"`
+}
+
+// tenantFile is the layout of a tenant profile in the YAML config file
+type tenantFile struct {
+	Server       string           `yaml:"server"`
+	Env          string           `yaml:"env"`
+	APIToken     datatypes.Secret `yaml:"apiToken"`
+	APITokenFile string           `yaml:"apiTokenFile"`
+	CAFile       string           `yaml:"caFile"`
+	Proxy        string           `yaml:"proxy"`
+}
+
+// defaultConfig returns the settings used when neither the config file nor the env set them
+func defaultConfig() datatypes.Config {
+	return datatypes.Config{
+		CachePastTTLSecs:    3600,
+		CacheTTLSecs:        60,
+		EvaluationWorkers:   4,
+		IdleTimeoutSecs:     60,
+		ListenAddress:       "0.0.0.0",
+		LogLevel:            "ERROR",
+		MaxRetries:          dynatrace.DefaultMaxRetries,
+		Port:                8080,
+		ReadTimeoutSecs:     15,
+		ReloadIntervalSecs:  10,
+		ShutdownTimeoutSecs: 15,
+		WriteTimeoutSecs:    15,
+	}
+}
+
+// GetConfig builds the config from the defaults, then the YAML file at path, if one is given, and finally the env,
+// which overrides both. An unreadable or invalid file is an error, while invalid env values are logged and ignored
+func GetConfig(path string) (datatypes.Config, error) {
+	return loadConfig(path, true)
+}
+
+// ReloadConfig builds the config in the same way as GetConfig, while one is already in effect. The env can't change
+// while the app runs, so the settings loaded from it aren't logged again, and the logging level is left to whoever
+// swaps the config in
+func ReloadConfig(path string) (datatypes.Config, error) {
+	return loadConfig(path, false)
+}
+
+// loadConfig builds the config for GetConfig and ReloadConfig. startup is whether this is the first config
+func loadConfig(path string, startup bool) (datatypes.Config, error) {
+	config := defaultConfig()
+
+	if path != "" {
+		err := readConfigFile(path, &config)
+		if err != nil {
+			return datatypes.Config{}, err
+		}
+		config.ConfigFile = path
+	}
+
+	applyEnv(&config, startup)
+
+	err := validateConfig(config)
+	if err != nil {
+		return datatypes.Config{}, err
+	}
+
+	return config, nil
+}
+
+// readConfigFile applies the settings of a YAML config file. Unknown keys are rejected, so typos don't go unnoticed
+func readConfigFile(path string, config *datatypes.Config) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read the config file %v: %w", path, err)
+	}
+
+	var file configFile
+	err = yaml.UnmarshalStrict(data, &file)
+	if err != nil {
+		return fmt.Errorf("could not parse the config file %v: %w", path, err)
+	}
+
+	setString(&config.ListenAddress, file.ListenAddress)
+	setInt(&config.Port, file.Port)
+	setInt(&config.EvaluationWorkers, file.EvaluationWorkers)
+	setString(&config.HistoryFile, file.HistoryFile)
+	setString(&config.SignaturesDir, file.SignaturesDir)
+	if len(file.CallbackAllowedHosts) > 0 {
+		config.CallbackAllowedHosts = file.CallbackAllowedHosts
+	}
+	if file.ReloadIntervalSecs != nil {
+		config.ReloadIntervalSecs = *file.ReloadIntervalSecs
+	}
+
+	setInt(&config.ReadTimeoutSecs, file.Timeouts.ReadSecs)
+	setInt(&config.WriteTimeoutSecs, file.Timeouts.WriteSecs)
+	setInt(&config.IdleTimeoutSecs, file.Timeouts.IdleSecs)
+	setInt(&config.ShutdownTimeoutSecs, file.Timeouts.ShutdownSecs)
+
+	setInt(&config.DefaultEventAge, file.Defaults.EventAge)
+	setInt(&config.DefaultEvaluationMins, file.Defaults.EvaluationMins)
+
+	setString(&config.Server, file.Dynatrace.Server)
+	setString(&config.Env, file.Dynatrace.Env)
+	if file.Dynatrace.APIToken != "" {
+		config.APIToken = file.Dynatrace.APIToken
+	}
+	setString(&config.APITokenFile, file.Dynatrace.APITokenFile)
+	setString(&config.CAFile, file.Dynatrace.CAFile)
+	setString(&config.Proxy, file.Dynatrace.Proxy)
+	setInt(&config.TimeoutSecs, file.Dynatrace.TimeoutSecs)
+	if file.Dynatrace.MaxRetries != nil {
+		config.MaxRetries = *file.Dynatrace.MaxRetries
+	}
+	if file.Dynatrace.CacheTTLSecs != nil {
+		config.CacheTTLSecs = *file.Dynatrace.CacheTTLSecs
+	}
+	if file.Dynatrace.CachePastTTLSecs != nil {
+		config.CachePastTTLSecs = *file.Dynatrace.CachePastTTLSecs
+	}
+
+	if len(file.Tenants) > 0 {
+		config.Tenants = map[string]datatypes.Tenant{}
+		for name, tenant := range file.Tenants {
+			config.Tenants[name] = datatypes.Tenant{
+				APIToken:     tenant.APIToken,
+				APITokenFile: tenant.APITokenFile,
+				CAFile:       tenant.CAFile,
+				Env:          tenant.Env,
+				Proxy:        tenant.Proxy,
+				Server:       tenant.Server,
+			}
+		}
+	}
+
+	setString(&config.LogLevel, strings.ToUpper(strings.TrimSpace(file.Logging.Level)))
+
+	return nil
+}
+
+// applyEnv overrides the config with the env vars which are set. Only at startup is each one logged, and the
+// logging level set right away
+func applyEnv(config *datatypes.Config, startup bool) {
+	logLevel := strings.ToUpper(strings.TrimSpace(os.Getenv("LOG_LEVEL")))
+	if logLevel != "" {
+		if validLogLevel(logLevel) {
+			config.LogLevel = logLevel
+			if startup {
+				logging.SetLogLevel(config.LogLevel)
+			}
+			logEnv(startup, fmt.Sprintf("LOG_LEVEL set to %v from env var", logLevel))
+		} else {
+			logging.LogError(datatypes.Logging{Message: fmt.Sprintf("LOG_LEVEL must be ERROR, INFO or DEBUG, but was %v. Using %v instead.", os.Getenv("LOG_LEVEL"), config.LogLevel)})
+		}
+	}
+
+	server := os.Getenv("DT_SERVER")
+	if server != "" {
+		config.Server = server
+		logEnv(startup, fmt.Sprintf("Loaded default DT_SERVER: %v. This can be overridden by an API POST with its own APIToken.", server))
+	}
+
+	env := os.Getenv("DT_ENV")
+	if env != "" {
+		config.Env = env
+		logEnv(startup, fmt.Sprintf("Loaded default DT_ENV: %v. This can be overridden by an API POST with its own APIToken.", env))
+	}
+
+	apiToken := os.Getenv("DT_API_TOKEN")
+	if apiToken != "" {
+		config.APIToken = datatypes.Secret(apiToken)
+		config.APITokenFile = ""
+		logEnv(startup, fmt.Sprintf("Loaded default DT_API_TOKEN: %v. This can be overridden with any API POST.", config.APIToken))
+	}
+
+	apiTokenFile := os.Getenv("DT_API_TOKEN_FILE")
+	if apiTokenFile != "" {
+		if apiToken != "" {
+			logging.LogError(datatypes.Logging{Message: "Both DT_API_TOKEN and DT_API_TOKEN_FILE are set. Using DT_API_TOKEN_FILE."})
+		}
+		config.APIToken = ""
+		config.APITokenFile = apiTokenFile
+		logEnv(startup, fmt.Sprintf("Loaded DT_API_TOKEN_FILE: %v. The default API token will be read from it.", apiTokenFile))
+	}
+
+	callbackAllowedHosts := os.Getenv("DT_CALLBACK_ALLOWED_HOSTS")
+	if callbackAllowedHosts != "" {
+		config.CallbackAllowedHosts = nil
+		for _, host := range strings.Split(callbackAllowedHosts, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				config.CallbackAllowedHosts = append(config.CallbackAllowedHosts, host)
+			}
+		}
+		logEnv(startup, fmt.Sprintf("Loaded DT_CALLBACK_ALLOWED_HOSTS: %v. Callbacks will only be sent to these hosts.", strings.Join(config.CallbackAllowedHosts, ", ")))
+	}
+
+	caFile := os.Getenv("DT_CA_FILE")
+	if caFile != "" {
+		config.CAFile = caFile
+		logEnv(startup, fmt.Sprintf("Loaded DT_CA_FILE: %v. Its certificates will be trusted when calling Dynatrace.", caFile))
+	}
+
+	historyFile := os.Getenv("DT_HISTORY_FILE")
+	if historyFile != "" {
+		config.HistoryFile = historyFile
+		logEnv(startup, fmt.Sprintf("Loaded DT_HISTORY_FILE: %v. Evaluations will be kept in this file.", historyFile))
+	}
+
+	proxy := os.Getenv("DT_PROXY")
+	if proxy != "" {
+		config.Proxy = proxy
+		logEnv(startup, fmt.Sprintf("Loaded DT_PROXY: %v. Requests to Dynatrace will use this proxy.", maskURLPassword(proxy)))
+	}
+
+	signaturesDir := os.Getenv("DT_SIGNATURES_DIR")
+	if signaturesDir != "" {
+		config.SignaturesDir = signaturesDir
+		logEnv(startup, fmt.Sprintf("Loaded DT_SIGNATURES_DIR: %v. Requests can reference the signatures in it.", signaturesDir))
+	}
+
+	envInt(startup, "DT_TIMEOUT_SECS", "a number of seconds", 0, &config.TimeoutSecs)
+	envInt(startup, "DT_MAX_RETRIES", "a number of retries", 0, &config.MaxRetries)
+	envInt(startup, "DT_CACHE_TTL_SECS", "a number of seconds", 0, &config.CacheTTLSecs)
+	envInt(startup, "DT_CACHE_PAST_TTL_SECS", "a number of seconds", 0, &config.CachePastTTLSecs)
+	envInt(startup, "DT_EVALUATION_WORKERS", "a positive number of workers", 1, &config.EvaluationWorkers)
+	envInt(startup, "DT_RELOAD_INTERVAL_SECS", "a number of seconds", 0, &config.ReloadIntervalSecs)
+}
+
+// envInt overrides value with the env var of the name, if it is set to a number of at least min
+func envInt(startup bool, name string, description string, min int, value *int) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return
+	}
+
+	parsed, err := strconv.Atoi(raw)
+	if err != nil || parsed < min {
+		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("%v must be %v, but was %v. Using %v instead.", name, description, raw, *value)})
+		return
+	}
+
+	*value = parsed
+	logEnv(startup, fmt.Sprintf("Loaded %v: %v.", name, parsed))
+}
+
+// logEnv logs a setting loaded from the env, only at startup
+func logEnv(startup bool, message string) {
+	if startup {
+		logging.LogInfo(datatypes.Logging{Message: message})
+	}
+}
+
+// validateConfig checks the settings which would keep the app from working
+func validateConfig(config datatypes.Config) error {
+	if config.Port < 1 || config.Port > 65535 {
+		return fmt.Errorf("the port must be between 1 and 65535, but was %v", config.Port)
+	}
+
+	if !validLogLevel(config.LogLevel) {
+		return fmt.Errorf("the logging level must be ERROR, INFO or DEBUG, but was %v", config.LogLevel)
+	}
+
+	if config.EvaluationWorkers < 1 {
+		return fmt.Errorf("there must be at least 1 evaluation worker")
+	}
+
+	nonNegative := map[string]int{
+		"cachePastTTLSecs":        config.CachePastTTLSecs,
+		"cacheTTLSecs":            config.CacheTTLSecs,
+		"defaults.evaluationMins": config.DefaultEvaluationMins,
+		"defaults.eventAge":       config.DefaultEventAge,
+		"maxRetries":              config.MaxRetries,
+		"reloadIntervalSecs":      config.ReloadIntervalSecs,
+		"timeouts.idleSecs":       config.IdleTimeoutSecs,
+		"timeouts.readSecs":       config.ReadTimeoutSecs,
+		"timeouts.shutdownSecs":   config.ShutdownTimeoutSecs,
+		"timeouts.writeSecs":      config.WriteTimeoutSecs,
+		"timeoutSecs":             config.TimeoutSecs,
+	}
+	var names []string
+	for name := range nonNegative {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if nonNegative[name] < 0 {
+			return fmt.Errorf("%v cannot be negative", name)
+		}
+	}
+
+	if config.APIToken != "" && config.APITokenFile != "" {
+		return fmt.Errorf("set either dynatrace.apiToken or dynatrace.apiTokenFile, not both")
+	}
+
+	for _, name := range tenantNames(config) {
+		if config.Tenants[name].APIToken != "" && config.Tenants[name].APITokenFile != "" {
+			return fmt.Errorf("set either apiToken or apiTokenFile for the tenant %v, not both", name)
+		}
+		if !tenantNameRegex.MatchString(name) {
+			return fmt.Errorf("the tenant name '%v' may only contain letters, digits, '.', '_' and '-'", name)
+		}
+		if config.Tenants[name].Server == "" {
+			return fmt.Errorf("the tenant %v has no server", name)
+		}
+	}
+
+	return nil
+}
+
+// validLogLevel checks whether a logging level is one the logging package knows
+func validLogLevel(level string) bool {
+	return level == "ERROR" || level == "INFO" || level == "DEBUG"
+}
+
+// tenantNames returns the names of the configured tenants in order
+func tenantNames(config datatypes.Config) []string {
+	var names []string
+	for name := range config.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// restartSettings are the settings which only take effect when goDynaPerfSignature is restarted
+var restartSettings = map[string]bool{
+	"evaluationWorkers":     true,
+	"historyFile":           true,
+	"listenAddress":         true,
+	"port":                  true,
+	"reloadIntervalSecs":    true,
+	"timeouts.idleSecs":     true,
+	"timeouts.readSecs":     true,
+	"timeouts.shutdownSecs": true,
+	"timeouts.writeSecs":    true,
+}
+
+// configSettings flattens the config into its settings, named as in the config file
+func configSettings(config datatypes.Config) map[string]interface{} {
+	settings := map[string]interface{}{
+		"apiToken":                config.APIToken,
+		"apiTokenFile":            config.APITokenFile,
+		"cachePastTTLSecs":        config.CachePastTTLSecs,
+		"cacheTTLSecs":            config.CacheTTLSecs,
+		"caFile":                  config.CAFile,
+		"callbackAllowedHosts":    strings.Join(config.CallbackAllowedHosts, ","),
+		"configFile":              config.ConfigFile,
+		"defaults.evaluationMins": config.DefaultEvaluationMins,
+		"defaults.eventAge":       config.DefaultEventAge,
+		"env":                     config.Env,
+		"evaluationWorkers":       config.EvaluationWorkers,
+		"historyFile":             config.HistoryFile,
+		"listenAddress":           config.ListenAddress,
+		"logging.level":           config.LogLevel,
+		"maxRetries":              config.MaxRetries,
+		"port":                    config.Port,
+		"proxy":                   config.Proxy,
+		"reloadIntervalSecs":      config.ReloadIntervalSecs,
+		"server":                  config.Server,
+		"signaturesDir":           config.SignaturesDir,
+		"timeoutSecs":             config.TimeoutSecs,
+		"timeouts.idleSecs":       config.IdleTimeoutSecs,
+		"timeouts.readSecs":       config.ReadTimeoutSecs,
+		"timeouts.shutdownSecs":   config.ShutdownTimeoutSecs,
+		"timeouts.writeSecs":      config.WriteTimeoutSecs,
+	}
+	for _, name := range tenantNames(config) {
+		tenant := config.Tenants[name]
+		prefix := "tenants." + name + "."
+		settings[prefix+"apiToken"] = tenant.APIToken
+		settings[prefix+"apiTokenFile"] = tenant.APITokenFile
+		settings[prefix+"caFile"] = tenant.CAFile
+		settings[prefix+"env"] = tenant.Env
+		settings[prefix+"proxy"] = tenant.Proxy
+		settings[prefix+"server"] = tenant.Server
+	}
+	return settings
+}
+
+// displaySetting formats a setting for the logs. Secrets mask themselves, and proxies can have a password in them
+func displaySetting(name string, value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if strings.HasSuffix(name, "proxy") {
+		return maskURLPassword(fmt.Sprint(value))
+	}
+	return fmt.Sprint(value)
+}
+
+// ConfigSummary describes the effective config in a single line, with secrets masked
+func ConfigSummary(config datatypes.Config) string {
+	settings := configSettings(config)
+
+	var names []string
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%v=%v", name, displaySetting(name, settings[name])))
+	}
+	return strings.Join(parts, " ")
+}
+
+// ConfigChanges describes each setting which differs between two configs, with secrets masked. Settings which only
+// take effect after a restart say so
+func ConfigChanges(previous datatypes.Config, current datatypes.Config) []string {
+	previousSettings := configSettings(previous)
+	currentSettings := configSettings(current)
+
+	names := map[string]bool{}
+	for name := range previousSettings {
+		names[name] = true
+	}
+	for name := range currentSettings {
+		names[name] = true
+	}
+
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	// Tenants which were added or removed are reported as a whole, rather than setting by setting
+	var changes []string
+	skipped := map[string]bool{}
+	skipTenant := func(name string, change string) {
+		changes = append(changes, fmt.Sprintf("tenants.%v was %v", name, change))
+		for setting := range configSettings(datatypes.Config{Tenants: map[string]datatypes.Tenant{name: {}}}) {
+			if strings.HasPrefix(setting, "tenants.") {
+				skipped[setting] = true
+			}
+		}
+	}
+	for _, name := range tenantNames(previous) {
+		if _, ok := current.Tenants[name]; !ok {
+			skipTenant(name, "removed")
+		}
+	}
+	for _, name := range tenantNames(current) {
+		if _, ok := previous.Tenants[name]; !ok {
+			skipTenant(name, "added")
+		}
+	}
+
+	for _, name := range sorted {
+		if previousSettings[name] == currentSettings[name] || skipped[name] {
+			continue
+		}
+
+		before := displaySetting(name, previousSettings[name])
+		after := displaySetting(name, currentSettings[name])
+
+		change := fmt.Sprintf("%v changed from '%v' to '%v'", name, before, after)
+		if before == after {
+			// The difference is in a masked value
+			change = fmt.Sprintf("%v changed", name)
+		}
+		if restartSettings[name] {
+			change += ", which takes effect after a restart"
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// LogConfigSummary logs the effective config, whatever the logging level
+func LogConfigSummary(config datatypes.Config) {
+	logging.LogSystem(datatypes.Logging{Message: fmt.Sprintf("Effective config: %v", ConfigSummary(config))})
+}
+
+// maskURLPassword hides the password of a URL such as a proxy with credentials
+func maskURLPassword(raw string) string {
+	at := strings.LastIndex(raw, "@")
+	scheme := strings.Index(raw, "://")
+	if at < 0 || scheme < 0 || at < scheme {
+		return raw
+	}
+
+	userInfo := raw[scheme+3 : at]
+	colon := strings.Index(userInfo, ":")
+	if colon < 0 {
+		return raw
+	}
+	return raw[:scheme+3] + userInfo[:colon] + ":****" + raw[at:]
+}
+
+func setString(value *string, override string) {
+	if override != "" {
+		*value = override
+	}
+}
+
+func setInt(value *int, override int) {
+	if override != 0 {
+		*value = override
+	}
+}
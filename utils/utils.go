@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 
 	"github.com/barrebre/goDynaPerfSignature/datatypes"
 	"github.com/barrebre/goDynaPerfSignature/logging"
@@ -12,49 +11,6 @@ import (
 
 const version = "1.7.0"
 
-// GetConfig retrives the config from the env
-// TODO: optimize this in the future so it doesn't check the getenv each time
-// TODO: change these vars to match the API vars
-func GetConfig() datatypes.Config {
-	logLevel := os.Getenv("LOG_LEVEL")
-	if logLevel != "" {
-		logging.SetLogLevel(logLevel)
-		logging.LogSystem(datatypes.Logging{Message: fmt.Sprintf("LOG_LEVEL set to %v from env var", logLevel)})
-	} else {
-		logging.LogSystem(datatypes.Logging{Message: "LOG_LEVEL not found in ENV. Defaulting to ERROR"})
-	}
-
-	logging.LogInfo(datatypes.Logging{Message: "** Reading in goDynaPerfSignature Config"})
-
-	server := os.Getenv("DT_SERVER")
-	if server == "" {
-		logging.LogInfo(datatypes.Logging{Message: "A Dynatrace server was not provided. Requests will not work unless a DT_SERVER is given in the POST body."})
-	} else {
-		logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Loaded default DT_SERVER: %v. This can be overridden with any API POST", server)})
-	}
-
-	env := os.Getenv("DT_ENV")
-	if env == "" {
-		logging.LogInfo(datatypes.Logging{Message: "A Dynatrace environment was not provided. If your tenant has multiple environments, you will need to include the DT_ENV in the POST body of requests."})
-	} else {
-		logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Loaded default DT_ENV: %v. This can be overridden with any API POST.", env)})
-	}
-
-	apiToken := os.Getenv("DT_API_TOKEN")
-	if apiToken == "" {
-		logging.LogInfo(datatypes.Logging{Message: "A Dynatrace API token was not provided. DT_API_TOKEN must be given with every API POST."})
-	} else {
-		logging.LogInfo(datatypes.Logging{Message: fmt.Sprintf("Loaded default DT_API_TOKEN: %v. This can be overridden with any API POST.", apiToken)})
-	}
-
-	config := datatypes.Config{
-		APIToken: apiToken,
-		Env:      env,
-		Server:   server,
-	}
-	return config
-}
-
 // GetAppVersion returns the tagged version of goDynaPerfSignature
 func GetAppVersion() string {
 	return version
@@ -64,7 +20,10 @@ func GetAppVersion() string {
 func WriteResponse(w http.ResponseWriter, response datatypes.PerformanceSignatureReturn, ps datatypes.PerformanceSignature) {
 	w.Header().Set("Content-Type", "application/json")
 	if response.Error {
-		w.WriteHeader(503)
+		w.WriteHeader(statusForErrorCode(response.ErrorCode))
+	} else if response.Pending {
+		w.Header().Set("Retry-After", fmt.Sprint(response.RetryAfterSecs))
+		w.WriteHeader(202)
 	} else if !response.Pass {
 		w.WriteHeader(406)
 	}
@@ -78,8 +37,9 @@ func WriteResponse(w http.ResponseWriter, response datatypes.PerformanceSignatur
 
 		w.WriteHeader(513)
 		marshalErrorJson := datatypes.PerformanceSignatureReturn{
-			Error:    true,
-			Response: []string{fmt.Sprintf("goDynaPerfSignature internal problem sending the response. The message was supposed to be: %v", response.Response)},
+			Error:     true,
+			ErrorCode: datatypes.ErrorCodeInternal,
+			Response:  []string{fmt.Sprintf("goDynaPerfSignature internal problem sending the response. The message was supposed to be: %v", response.Response)},
 		}
 
 		errorJson, err2 := json.Marshal(marshalErrorJson)
@@ -95,3 +55,61 @@ func WriteResponse(w http.ResponseWriter, response datatypes.PerformanceSignatur
 
 	w.Write(responseJson)
 }
+
+// WriteDeploymentResponse helps respond to requests to /deployment
+func WriteDeploymentResponse(w http.ResponseWriter, response datatypes.DeploymentReturn) {
+	w.Header().Set("Content-Type", "application/json")
+
+	responseJson, err := json.Marshal(response)
+	if err != nil {
+		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Couldn't marshal json for deployment response. Error: %v.", err)})
+		w.WriteHeader(513)
+		return
+	}
+
+	if response.Error {
+		w.WriteHeader(statusForErrorCode(response.ErrorCode))
+	}
+
+	w.Write(responseJson)
+}
+
+// statusForErrorCode picks the HTTP status for an error, so callers can tell their own mistakes from Dynatrace's
+func statusForErrorCode(errorCode string) int {
+	switch errorCode {
+	case datatypes.ErrorCodeInvalidRequest, datatypes.ErrorCodeInvalidMetricSelector:
+		return http.StatusBadRequest
+	case datatypes.ErrorCodeAuthFailed:
+		return http.StatusUnauthorized
+	case datatypes.ErrorCodeNotFound:
+		return http.StatusNotFound
+	case datatypes.ErrorCodeRateLimited:
+		return http.StatusTooManyRequests
+	case datatypes.ErrorCodeInternal:
+		return http.StatusInternalServerError
+	case datatypes.ErrorCodeDynatraceError, datatypes.ErrorCodeDynatraceUnreachable:
+		return http.StatusBadGateway
+	case datatypes.ErrorCodeTimeout:
+		return http.StatusGatewayTimeout
+	case datatypes.ErrorCodeQueueFull:
+		return http.StatusServiceUnavailable
+	}
+
+	// Cancelled requests and anything unclassified keep the original behaviour
+	return http.StatusServiceUnavailable
+}
+
+// WriteJSON responds with v as JSON and the status. what describes the response in the log, should it fail to marshal
+func WriteJSON(w http.ResponseWriter, status int, v interface{}, what string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	responseJson, err := json.Marshal(v)
+	if err != nil {
+		logging.LogError(datatypes.Logging{Message: fmt.Sprintf("Couldn't marshal json for %v response. Error: %v.", what, err)})
+		w.WriteHeader(513)
+		return
+	}
+
+	w.WriteHeader(status)
+	w.Write(responseJson)
+}
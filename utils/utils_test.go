@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/barrebre/goDynaPerfSignature/datatypes"
 	"github.com/stretchr/testify/assert"
@@ -73,7 +74,7 @@ func TestGetConfig(t *testing.T) {
 				os.Setenv("DT_API_TOKEN", "abc1234")
 			}
 
-			GetConfig()
+			GetConfig("")
 		})
 	}
 }
@@ -99,6 +100,18 @@ func TestWriteResponse(t *testing.T) {
 			ExpectedResponse:           []string{"No previous metrics to compare against for metric dummy_metric_name:avg", "PASS - dummy_metric_name:percentile(90) is below the static threshold (1234.12) with a value of 12.34."},
 			PerformanceSignatureReturn: datatypes.GetValidPerformanceSignatureReturnFailure(),
 		},
+		{
+			Name:                       "Pending deployment",
+			ExpectedCode:               202,
+			ExpectedResponse:           []string{"PENDING - the evaluation window from 1234 to 2345 has not finished, or its data is still being ingested. Retry in 120 seconds"},
+			PerformanceSignatureReturn: datatypes.GetValidPerformanceSignatureReturnPending(),
+		},
+		{
+			Name:                       "Error deployment",
+			ExpectedCode:               401,
+			ExpectedResponse:           []string{"Encountered error gathering event timestamps from Dynatrace: invalid status code from Dynatrace: 401 (Token Authentication failed)"},
+			PerformanceSignatureReturn: datatypes.GetValidPerformanceSignatureReturnAuthFailed(),
+		},
 	}
 
 	for _, test := range tests {
@@ -119,6 +132,100 @@ func TestWriteResponse(t *testing.T) {
 	}
 }
 
+func TestStatusForErrorCode(t *testing.T) {
+	assert.Equal(t, 400, statusForErrorCode(datatypes.ErrorCodeInvalidRequest))
+	assert.Equal(t, 400, statusForErrorCode(datatypes.ErrorCodeInvalidMetricSelector))
+	assert.Equal(t, 401, statusForErrorCode(datatypes.ErrorCodeAuthFailed))
+	assert.Equal(t, 404, statusForErrorCode(datatypes.ErrorCodeNotFound))
+	assert.Equal(t, 429, statusForErrorCode(datatypes.ErrorCodeRateLimited))
+	assert.Equal(t, 500, statusForErrorCode(datatypes.ErrorCodeInternal))
+	assert.Equal(t, 502, statusForErrorCode(datatypes.ErrorCodeDynatraceError))
+	assert.Equal(t, 502, statusForErrorCode(datatypes.ErrorCodeDynatraceUnreachable))
+	assert.Equal(t, 504, statusForErrorCode(datatypes.ErrorCodeTimeout))
+	assert.Equal(t, 503, statusForErrorCode(datatypes.ErrorCodeCancelled))
+	assert.Equal(t, 503, statusForErrorCode(datatypes.ErrorCodeQueueFull))
+	assert.Equal(t, 503, statusForErrorCode(""))
+}
+
+func TestWriteJSON(t *testing.T) {
+	type testDefs struct {
+		Name           string
+		Status         int
+		Value          interface{}
+		ExpectedStatus int
+		ExpectedBody   string
+	}
+
+	tests := []testDefs{
+		{
+			Name:           "Cache stats",
+			Status:         200,
+			Value:          datatypes.CacheStats{Entries: 2, Hits: 5, Misses: 3},
+			ExpectedStatus: 200,
+			ExpectedBody:   `{"Entries":2,"Hits":5,"Misses":3}`,
+		},
+		{
+			Name:   "Evaluation job",
+			Status: 202,
+			Value: datatypes.EvaluationJob{
+				ID:          "abc",
+				Status:      datatypes.EvaluationStatusPending,
+				SubmittedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			},
+			ExpectedStatus: 202,
+			ExpectedBody:   `{"ID":"abc","Status":"pending","SubmittedAt":"2020-01-02T03:04:05Z"}`,
+		},
+		{
+			Name:           "Empty list",
+			Status:         200,
+			Value:          []datatypes.Signature{},
+			ExpectedStatus: 200,
+			ExpectedBody:   `[]`,
+		},
+		{
+			Name:           "Signature",
+			Status:         200,
+			Value:          datatypes.Signature{Name: "checkout-api", Version: 2},
+			ExpectedStatus: 200,
+			ExpectedBody:   `{"Name":"checkout-api","PSMetrics":null,"Version":2}`,
+		},
+		{
+			Name:           "Unmarshalable value",
+			Status:         200,
+			Value:          map[string]interface{}{"bad": make(chan int)},
+			ExpectedStatus: 513,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			WriteJSON(w, test.Status, test.Value, "test")
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+
+			assert.Equal(t, test.ExpectedStatus, resp.StatusCode)
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+			if test.ExpectedBody != "" {
+				assert.JSONEq(t, test.ExpectedBody, string(body))
+			} else {
+				assert.Empty(t, body)
+			}
+		})
+	}
+
+	// Records go through it in full
+	w := httptest.NewRecorder()
+	record := datatypes.GetEvaluationRecord()
+	WriteJSON(w, 200, record, "history record")
+
+	var written datatypes.EvaluationRecord
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &written))
+	assert.Equal(t, record.ID, written.ID)
+	assert.Equal(t, record.Services, written.Services)
+}
+
 // TestGetAppVersion is just for coverage
 func TestGetAppVersion(t *testing.T) {
 	GetAppVersion()